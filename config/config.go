@@ -1,34 +1,47 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/multierror"
+	"gopkg.in/yaml.v3"
 )
 
 type MessageBusServerSchema struct {
-	Host     string `json:"host"`
-	User     string `json:"user"`
-	Password string `json:"password"`
+	Host     string `json:"host" yaml:"host"`
+	User     string `json:"user" yaml:"user"`
+	Password string `json:"password" yaml:"password"`
+
+	PasswordFile string `json:"password_file,omitempty" yaml:"password_file,omitempty"`
 }
 
 type RoutingAPISchema struct {
-	APIURL            string `json:"api_url"`
-	OAuthURL          string `json:"oauth_url"`
-	ClientID          string `json:"client_id"`
-	ClientSecret      string `json:"client_secret"`
-	CACerts           string `json:"ca_certs"`
-	SkipSSLValidation bool   `json:"skip_ssl_validation"`
-
-	ClientCertificatePath   string `json:"client_cert_path"`
-	ClientPrivateKeyPath    string `json:"client_private_key_path"`
-	ServerCACertificatePath string `json:"server_ca_cert_path"`
-	MaxTTL                  string `json:"max_ttl,omitempty"`
+	APIURL            string `json:"api_url" yaml:"api_url"`
+	OAuthURL          string `json:"oauth_url" yaml:"oauth_url"`
+	ClientID          string `json:"client_id" yaml:"client_id"`
+	ClientSecret      string `json:"client_secret" yaml:"client_secret"`
+	ClientSecretFile  string `json:"client_secret_file,omitempty" yaml:"client_secret_file,omitempty"`
+	CACerts           string `json:"ca_certs" yaml:"ca_certs"`
+	SkipSSLValidation bool   `json:"skip_ssl_validation" yaml:"skip_ssl_validation"`
+
+	ClientCertificatePath   string `json:"client_cert_path" yaml:"client_cert_path"`
+	ClientPrivateKeyPath    string `json:"client_private_key_path" yaml:"client_private_key_path"`
+	ServerCACertificatePath string `json:"server_ca_cert_path" yaml:"server_ca_cert_path"`
+	MaxTTL                  string `json:"max_ttl,omitempty" yaml:"max_ttl,omitempty"`
+	BatchWindow             string `json:"batch_window,omitempty" yaml:"batch_window,omitempty"`
+	ReconcileStaleTCPRoutes bool   `json:"reconcile_stale_tcp_routes,omitempty" yaml:"reconcile_stale_tcp_routes,omitempty"`
+	ReconcileDryRun         bool   `json:"reconcile_dry_run,omitempty" yaml:"reconcile_dry_run,omitempty"`
+	WatchTCPRouteEvents     bool   `json:"watch_tcp_route_events,omitempty" yaml:"watch_tcp_route_events,omitempty"`
 }
 
 type HealthCheckSchema struct {
@@ -38,54 +51,108 @@ type HealthCheckSchema struct {
 }
 
 type ConfigSchema struct {
-	MessageBusServers          []MessageBusServerSchema `json:"message_bus_servers"`
-	RoutingAPI                 RoutingAPISchema         `json:"routing_api"`
-	Routes                     []RouteSchema            `json:"routes"`
-	DynamicConfigGlobs         []string                 `json:"dynamic_config_globs"`
-	NATSmTLSConfig             ClientTLSConfigSchema    `json:"nats_mtls_config"`
-	Host                       string                   `json:"host"`
-	AvailabilityZone           string                   `json:"availability_zone"`
-	UnregistrationMessageLimit *int                     `json:"unregistration_message_limit,omitempty"`
+	MessageBusServers          []MessageBusServerSchema    `json:"message_bus_servers" yaml:"message_bus_servers"`
+	RoutingAPI                 RoutingAPISchema            `json:"routing_api" yaml:"routing_api"`
+	Routes                     []RouteSchema               `json:"routes" yaml:"routes"`
+	DynamicConfigGlobs         []string                    `json:"dynamic_config_globs" yaml:"dynamic_config_globs"`
+	NATSmTLSConfig             ClientTLSConfigSchema       `json:"nats_mtls_config" yaml:"nats_mtls_config"`
+	Host                       string                      `json:"host" yaml:"host"`
+	HostInterface              string                      `json:"host_interface,omitempty" yaml:"host_interface,omitempty"`
+	HostCIDR                   string                      `json:"host_cidr,omitempty" yaml:"host_cidr,omitempty"`
+	HostIPPreference           string                      `json:"host_ip_preference,omitempty" yaml:"host_ip_preference,omitempty"`
+	AvailabilityZone           string                      `json:"availability_zone" yaml:"availability_zone"`
+	Deployment                 string                      `json:"deployment,omitempty" yaml:"deployment,omitempty"`
+	InstanceID                 string                      `json:"instance_id,omitempty" yaml:"instance_id,omitempty"`
+	TemplateEnv                []string                    `json:"template_env,omitempty" yaml:"template_env,omitempty"`
+	UnregistrationMessageLimit *int                        `json:"unregistration_message_limit,omitempty" yaml:"unregistration_message_limit,omitempty"`
+	AllowUnknownRouteOptions   bool                        `json:"allow_unknown_route_options,omitempty" yaml:"allow_unknown_route_options,omitempty"`
+	HTTP2RequiresTLSPort       bool                        `json:"http2_requires_tls_port,omitempty" yaml:"http2_requires_tls_port,omitempty"`
+	Transport                  string                      `json:"transport,omitempty" yaml:"transport,omitempty"`
+	CertificateReloadInterval  string                      `json:"certificate_reload_interval,omitempty" yaml:"certificate_reload_interval,omitempty"`
+	CertificateExpiryWarning   string                      `json:"certificate_expiry_warning,omitempty" yaml:"certificate_expiry_warning,omitempty"`
+	DebugAddress               string                      `json:"debug_address,omitempty" yaml:"debug_address,omitempty"`
+	StrictConfig               *bool                       `json:"strict_config,omitempty" yaml:"strict_config,omitempty"`
+	RouteDefaults              RouteDefaultsSchema         `json:"route_defaults,omitempty" yaml:"route_defaults,omitempty"`
+	DynamicConfigPolicies      []DynamicConfigPolicySchema `json:"dynamic_config_policies,omitempty" yaml:"dynamic_config_policies,omitempty"`
 }
 
 type RouteSchema struct {
-	Type                 string             `json:"type" yaml:"type"`
-	Name                 string             `json:"name" yaml:"name"`
-	Host                 string             `json:"host" yaml:"host"`
-	Port                 *uint16            `json:"port" yaml:"port"`
-	Protocol             string             `json:"protocol" yaml:"protocol"`
-	SniPort              *uint16            `json:"sni_port" yaml:"sni_port"`
-	TLSPort              *uint16            `json:"tls_port" yaml:"tls_port"`
-	Tags                 map[string]string  `json:"tags" yaml:"tags"`
-	URIs                 []string           `json:"uris" yaml:"uris"`
-	RouterGroup          string             `json:"router_group" yaml:"router_group"`
-	ExternalPort         *uint16            `json:"external_port,omitempty" yaml:"external_port,omitempty"`
-	RouteServiceUrl      string             `json:"route_service_url" yaml:"route_service_url"`
-	RegistrationInterval string             `json:"registration_interval,omitempty" yaml:"registration_interval,omitempty"`
-	HealthCheck          *HealthCheckSchema `json:"health_check,omitempty" yaml:"health_check,omitempty"`
-	ServerCertDomainSAN  string             `json:"server_cert_domain_san,omitempty" yaml:"server_cert_domain_san,omitempty"`
-	SniRoutableSan       string             `json:"sni_routable_san,omitempty" yaml:"sni_routable_san,omitempty"`
-	Options              *Options           `json:"options,omitempty" yaml:"options,omitempty"`
+	Type                    string             `json:"type" yaml:"type"`
+	Name                    string             `json:"name" yaml:"name"`
+	Host                    string             `json:"host" yaml:"host"`
+	Port                    *uint16            `json:"port" yaml:"port"`
+	Protocol                string             `json:"protocol" yaml:"protocol"`
+	SniPort                 *uint16            `json:"sni_port" yaml:"sni_port"`
+	TLSPort                 *uint16            `json:"tls_port" yaml:"tls_port"`
+	Tags                    map[string]string  `json:"tags" yaml:"tags"`
+	URIs                    []string           `json:"uris" yaml:"uris"`
+	RouterGroup             string             `json:"router_group" yaml:"router_group"`
+	ExternalPort            *uint16            `json:"external_port,omitempty" yaml:"external_port,omitempty"`
+	PortRange               string             `json:"port_range,omitempty" yaml:"port_range,omitempty"`
+	ExternalPortRange       string             `json:"external_port_range,omitempty" yaml:"external_port_range,omitempty"`
+	RouteServiceUrl         string             `json:"route_service_url" yaml:"route_service_url"`
+	RegistrationInterval    string             `json:"registration_interval,omitempty" yaml:"registration_interval,omitempty"`
+	HealthCheck             *HealthCheckSchema `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+	ServerCertDomainSAN     string             `json:"server_cert_domain_san,omitempty" yaml:"server_cert_domain_san,omitempty"`
+	SniRoutableSan          string             `json:"sni_routable_san,omitempty" yaml:"sni_routable_san,omitempty"`
+	Options                 *Options           `json:"options,omitempty" yaml:"options,omitempty"`
+	App                     string             `json:"app,omitempty" yaml:"app,omitempty"`
+	PrivateInstanceIndex    string             `json:"private_instance_index,omitempty" yaml:"private_instance_index,omitempty"`
+	IsolationSegment        string             `json:"isolation_segment,omitempty" yaml:"isolation_segment,omitempty"`
+	StaleThresholdInSeconds int                `json:"stale_threshold_in_seconds,omitempty" yaml:"stale_threshold_in_seconds,omitempty"`
+	Transport               string             `json:"transport,omitempty" yaml:"transport,omitempty"`
+	InstanceID              string             `json:"instance_id,omitempty" yaml:"instance_id,omitempty"`
+	AvailabilityZone        string             `json:"availability_zone,omitempty" yaml:"availability_zone,omitempty"`
 }
 
 type Options struct {
 	LoadBalancingAlgorithm LoadBalancingAlgorithm `json:"loadbalancing,omitempty" yaml:"loadbalancing,omitempty"`
+	HashHeader             string                 `json:"hash_header,omitempty" yaml:"hash_header,omitempty"`
+	HashBalance            float64                `json:"hash_balance,omitempty" yaml:"hash_balance,omitempty"`
+
+	// Unknown holds options route-registrar does not know about. They are
+	// only accepted when allow_unknown_route_options is set and are then
+	// forwarded to gorouter verbatim.
+	Unknown map[string]string `json:"-" yaml:"-"`
 }
 
+// knownRouteOptions lists the keys of the typed fields of Options.
+var knownRouteOptions = []string{"loadbalancing", "hash_header", "hash_balance"}
+
 type LoadBalancingAlgorithm string
 
-var supportedLoadBalancingAlgorithms = []LoadBalancingAlgorithm{RoundRobin, LeastConns}
+var supportedLoadBalancingAlgorithms = []LoadBalancingAlgorithm{RoundRobin, LeastConns, Hash}
 
 const (
 	RoundRobin LoadBalancingAlgorithm = "round-robin"
 	LeastConns LoadBalancingAlgorithm = "least-connection"
+	Hash       LoadBalancingAlgorithm = "hash"
+)
+
+const (
+	minHashBalance = 1.1
+	maxHashBalance = 10.0
+)
+
+const (
+	defaultCertificateReloadInterval = time.Minute
+	defaultCertificateExpiryWarning  = 30 * 24 * time.Hour
 )
 
+// Transports HTTP routes can be registered with. TCP routes are always
+// registered with the routing API.
+const (
+	TransportNATS       = "nats"
+	TransportRoutingAPI = "routing_api"
+)
+
+var httpHeaderNameRegexp = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+
 type ClientTLSConfigSchema struct {
-	Enabled  bool   `json:"enabled"`
-	CertPath string `json:"cert_path"`
-	KeyPath  string `json:"key_path"`
-	CAPath   string `json:"ca_path"`
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+	CertPath string `json:"cert_path" yaml:"cert_path"`
+	KeyPath  string `json:"key_path" yaml:"key_path"`
+	CAPath   string `json:"ca_path" yaml:"ca_path"`
 }
 
 type MessageBusServer struct {
@@ -106,7 +173,11 @@ type RoutingAPI struct {
 	ClientPrivateKeyPath    string
 	ServerCACertificatePath string
 
-	MaxTTL time.Duration
+	MaxTTL                  time.Duration
+	BatchWindow             time.Duration
+	ReconcileStaleTCPRoutes bool
+	ReconcileDryRun         bool
+	WatchTCPRouteEvents     bool
 }
 
 type HealthCheck struct {
@@ -123,7 +194,19 @@ type Config struct {
 	NATSmTLSConfig             ClientTLSConfig
 	Host                       string
 	AvailabilityZone           string `json:"availability_zone"`
+	Deployment                 string
+	InstanceID                 string
+	TemplateEnv                []string
 	UnregistrationMessageLimit int
+	AllowUnknownRouteOptions   bool
+	HTTP2RequiresTLSPort       bool
+	Transport                  string
+	CertificateReloadInterval  time.Duration
+	CertificateExpiryWarning   time.Duration
+	DebugAddress               string
+	StrictConfig               bool
+	RouteDefaults              RouteDefaultsSchema
+	DynamicConfigPolicies      []DynamicConfigPolicy
 }
 
 type ClientTLSConfig struct {
@@ -134,23 +217,37 @@ type ClientTLSConfig struct {
 }
 
 type Route struct {
-	Type                 string
-	Name                 string
-	Port                 *uint16
-	Protocol             string
-	TLSPort              *uint16
-	Tags                 map[string]string
-	URIs                 []string
-	RouterGroup          string
-	Host                 string
-	ExternalPort         *uint16
-	RouteServiceUrl      string
-	RegistrationInterval time.Duration
-	HealthCheck          *HealthCheck
-	ServerCertDomainSAN  string
-	Options              *Options
+	Type                    string
+	Name                    string
+	Port                    *uint16
+	Protocol                string
+	TLSPort                 *uint16
+	Tags                    map[string]string
+	URIs                    []string
+	RouterGroup             string
+	Host                    string
+	ExternalPort            *uint16
+	RouteServiceUrl         string
+	RegistrationInterval    time.Duration
+	HealthCheck             *HealthCheck
+	ServerCertDomainSAN     string
+	Options                 *Options
+	App                     string
+	PrivateInstanceIndex    string
+	IsolationSegment        string
+	StaleThresholdInSeconds int
+	Transport               string
+	InstanceID              string
+	AvailabilityZone        string
 }
 
+// NewConfigSchemaFromFile reads a JSON or YAML config file. Files ending in
+// .json and files starting with '{', such as the registrar_settings.yml
+// files rendered as JSON, are parsed as JSON. Other files, and .yml or .yaml
+// files that are not valid JSON, are parsed as YAML, and strict_config
+// defaults to true for them. When the file has unknown
+// fields, the parsed schema is returned with the error, so that it can still
+// be validated.
 func NewConfigSchemaFromFile(configFile string) (ConfigSchema, error) {
 	var config ConfigSchema
 
@@ -159,17 +256,119 @@ func NewConfigSchemaFromFile(configFile string) (ConfigSchema, error) {
 		return ConfigSchema{}, err
 	}
 
-	err = json.Unmarshal(c, &config)
+	ext := strings.ToLower(filepath.Ext(configFile))
+	yamlExt := ext == ".yml" || ext == ".yaml"
+
+	parsed := false
+	var jsonErr error
+	if ext == ".json" || bytes.HasPrefix(bytes.TrimSpace(c), []byte("{")) {
+		jsonErr = json.Unmarshal(c, &config)
+		if jsonErr != nil && !yamlExt {
+			return ConfigSchema{}, jsonErr
+		}
+		parsed = jsonErr == nil
+	}
+
+	if !parsed {
+		config = ConfigSchema{}
+		err = yaml.Unmarshal(c, &config)
+		if err != nil {
+			// A YAML file starting with "{" may be meant as either, so the
+			// JSON error is reported as well.
+			if jsonErr != nil {
+				return ConfigSchema{}, fmt.Errorf("failed to parse %s as JSON: %s; as YAML: %s", configFile, jsonErr, err)
+			}
+			return ConfigSchema{}, err
+		}
+
+		// Only newer versions accept YAML, so YAML configs are strict unless
+		// strict_config is false, while JSON configs keep ignoring unknown
+		// fields.
+		if config.StrictConfig == nil {
+			strict := true
+			config.StrictConfig = &strict
+		}
+	}
+
+	err = checkUnknownFields(configFile, c, config)
 	if err != nil {
-		return ConfigSchema{}, err
+		return config, err
 	}
 
 	return config, nil
 }
 
+// checkUnknownFields returns an error listing the unknown fields in the
+// config file if the config is strict.
+func checkUnknownFields(configFile string, data []byte, config ConfigSchema) error {
+	if !config.strict() {
+		return nil
+	}
+
+	unknownFields, err := UnknownFields(data, ConfigSchema{})
+	if err != nil {
+		return err
+	}
+	if len(unknownFields) == 0 {
+		return nil
+	}
+
+	errors := multierror.NewMultiError(configFile)
+	for _, unknownField := range unknownFields {
+		errors.Add(unknownField)
+	}
+	return errors
+}
+
+// strict returns whether unknown fields are rejected, which they are when
+// strict_config is true, the default for YAML config files.
+func (c ConfigSchema) strict() bool {
+	return c.StrictConfig != nil && *c.StrictConfig
+}
+
 func (c ConfigSchema) ParseSchemaAndSetDefaultsToConfig() (*Config, error) {
+	config, _, err := c.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ValidateSchema parses the schema like ParseSchemaAndSetDefaultsToConfig,
+// but without resolving what depends on the machine the route-registrar runs
+// on: ${ENV_VAR} references, password_file, client_secret_file and the host
+// detection are only checked as far as possible and returned as skipped. The
+// config is returned even when there are errors, with the routes that are
+// valid, so that the dynamic config files can still be validated against it.
+func (c ConfigSchema) ValidateSchema() (*Config, []string, error) {
+	return c.parse(true)
+}
+
+func (c ConfigSchema) parse(skipResolving bool) (*Config, []string, error) {
 	errors := multierror.NewMultiError("config")
 
+	c.MessageBusServers = append([]MessageBusServerSchema{}, c.MessageBusServers...)
+	secretErrors, skipped := c.resolveSecrets(skipResolving)
+	for _, err := range secretErrors {
+		errors.Add(err)
+	}
+
+	skippedHost, err := c.resolveHost(skipResolving)
+	if err != nil {
+		errors.Add(err)
+	}
+	if skippedHost != "" {
+		skipped = append(skipped, skippedHost)
+	}
+	if c.Host != "" {
+		host, err := normalizeHost(c.Host)
+		if err != nil {
+			errors.Add(err)
+		} else {
+			c.Host = host
+		}
+	}
+
 	if c.UnregistrationMessageLimit == nil {
 		defaultUnregistrationLimit := 5
 		c.UnregistrationMessageLimit = &defaultUnregistrationLimit
@@ -179,35 +378,110 @@ func (c ConfigSchema) ParseSchemaAndSetDefaultsToConfig() (*Config, error) {
 		errors.Add(fmt.Errorf("unregistration_message_limit must be a positive integer"))
 	}
 
-	tcp_routes := 0
+	err = validateTransport(c.Transport)
+	if err != nil {
+		errors.Add(err)
+	}
+	transport := c.Transport
+	if transport == "" {
+		transport = TransportNATS
+	}
+
+	certificateReloadInterval, err := parseOptionalDuration("certificate_reload_interval", c.CertificateReloadInterval, defaultCertificateReloadInterval)
+	if err != nil {
+		errors.Add(err)
+	}
+
+	certificateExpiryWarning, err := parseOptionalDuration("certificate_expiry_warning", c.CertificateExpiryWarning, defaultCertificateExpiryWarning)
+	if err != nil {
+		errors.Add(err)
+	}
+
+	if c.DebugAddress != "" {
+		_, _, err := net.SplitHostPort(c.DebugAddress)
+		if err != nil {
+			errors.Add(fmt.Errorf("invalid debug_address: %s", err))
+		}
+	}
+
+	nats_routes := 0
+	routing_api_routes := 0
+
+	templateData, err := NewTemplateData(Config{
+		Host:             c.Host,
+		AvailabilityZone: c.AvailabilityZone,
+		Deployment:       c.Deployment,
+		InstanceID:       c.InstanceID,
+		TemplateEnv:      c.TemplateEnv,
+	})
+	if err != nil {
+		errors.Add(err)
+	}
+	if skipResolving {
+		for _, name := range c.TemplateEnv {
+			if _, ok := templateData.Env[name]; !ok && templateData.Env != nil {
+				skipped = append(skipped, fmt.Sprintf("template_env: %s is not set", name))
+				templateData.Env[name] = placeholderSecret
+			}
+		}
+	}
 
 	routes := []Route{}
 	for index, r := range c.Routes {
-		route, err := RouteFromSchema(r, index, c.Host)
+		routeSchema, err := r.WithDefaults(c.RouteDefaults).ExpandTemplates(templateData, index)
 		if err != nil {
 			errors.Add(err)
 			continue
 		}
 
-		if route.Type == "tcp" {
-			tcp_routes++
+		expanded, err := RoutesFromSchema(routeSchema, index, c.Host, RouteParseOptions{
+			AllowUnknownOptions:  c.AllowUnknownRouteOptions,
+			HTTP2RequiresTLSPort: c.HTTP2RequiresTLSPort,
+		})
+		if err != nil {
+			errors.Add(err)
+			continue
+		}
+
+		for _, route := range expanded {
+			if route.EffectiveTransport(transport) == TransportRoutingAPI {
+				// Whether routing_api is configured is checked below, once.
+				err := route.ValidateTransport(transport, true)
+				if err != nil {
+					errors.Add(fmt.Errorf("route %s: %s", nameOrIndex(r, index), err))
+				}
+				routing_api_routes++
+			} else {
+				nats_routes++
+			}
 		}
 
-		routes = append(routes, *route)
+		routes = append(routes, expanded...)
 	}
 
-	messageBusServers, err := messageBusServersFromSchema(c.MessageBusServers)
-	if err != nil && (len(routes)-tcp_routes > 0) {
+	claims := NewRouteClaims()
+	for _, route := range routes {
+		err := claims.Claim(route, MainConfigSource)
+		if err != nil {
+			errors.Add(err)
+		}
+	}
+
+	dynamicConfigPolicies, err := dynamicConfigPoliciesFromSchema(c.DynamicConfigPolicies)
+	if err != nil {
 		errors.Add(err)
 	}
 
-	routingAPI, err := routingAPIFromSchema(c.RoutingAPI)
-	if err != nil && tcp_routes > 0 {
+	messageBusServers, err := messageBusServersFromSchema(c.MessageBusServers)
+	if err != nil && nats_routes > 0 {
 		errors.Add(err)
 	}
 
-	if errors.Length() > 0 {
-		return nil, errors
+	// Dynamic routes use the global transport as well, so routing_api is
+	// required for it even when no static route uses it.
+	routingAPI, err := routingAPIFromSchema(c.RoutingAPI)
+	if err != nil && (routing_api_routes > 0 || transport == TransportRoutingAPI) {
+		errors.Add(err)
 	}
 
 	natsTLSConfig := clientTLSConfigFromSchema(c.NATSmTLSConfig)
@@ -215,17 +489,49 @@ func (c ConfigSchema) ParseSchemaAndSetDefaultsToConfig() (*Config, error) {
 	config := Config{
 		Host:                       c.Host,
 		AvailabilityZone:           c.AvailabilityZone,
+		Deployment:                 c.Deployment,
+		InstanceID:                 c.InstanceID,
+		TemplateEnv:                c.TemplateEnv,
 		UnregistrationMessageLimit: *c.UnregistrationMessageLimit,
+		AllowUnknownRouteOptions:   c.AllowUnknownRouteOptions,
+		HTTP2RequiresTLSPort:       c.HTTP2RequiresTLSPort,
+		Transport:                  transport,
+		CertificateReloadInterval:  certificateReloadInterval,
+		CertificateExpiryWarning:   certificateExpiryWarning,
+		DebugAddress:               c.DebugAddress,
+		StrictConfig:               c.strict(),
+		RouteDefaults:              c.RouteDefaults,
 		MessageBusServers:          messageBusServers,
 		Routes:                     routes,
 		DynamicConfigGlobs:         c.DynamicConfigGlobs,
+		DynamicConfigPolicies:      dynamicConfigPolicies,
 		NATSmTLSConfig:             natsTLSConfig,
 	}
 	if routingAPI != nil {
 		config.RoutingAPI = *routingAPI
 	}
 
-	return &config, nil
+	if errors.Length() > 0 {
+		return &config, skipped, errors
+	}
+	return &config, skipped, nil
+}
+
+// parseOptionalDuration parses a non-negative duration, returning
+// defaultDuration when it is not set.
+func parseOptionalDuration(name string, duration string, defaultDuration time.Duration) (time.Duration, error) {
+	if duration == "" {
+		return defaultDuration, nil
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", name, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative: %s", name, duration)
+	}
+	return d, nil
 }
 
 func nameOrIndex(r RouteSchema, index int) string {
@@ -236,6 +542,47 @@ func nameOrIndex(r RouteSchema, index int) string {
 	return strconv.Itoa(index)
 }
 
+// EffectiveTransport returns the transport the route is registered with when
+// transport is configured globally.
+func (r Route) EffectiveTransport(transport string) string {
+	if r.Type == "tcp" {
+		return TransportRoutingAPI
+	}
+	if r.Transport != "" {
+		return r.Transport
+	}
+	if transport != "" {
+		return transport
+	}
+	return TransportNATS
+}
+
+// ValidateTransport returns an error when the route cannot be registered with
+// the transport it is registered with when transport is configured globally:
+// the routing API must be configured, and HTTP routes registered with it need
+// a port.
+func (r Route) ValidateTransport(transport string, routingAPIConfigured bool) error {
+	if r.EffectiveTransport(transport) != TransportRoutingAPI {
+		return nil
+	}
+	if !routingAPIConfigured {
+		return fmt.Errorf("transport %s requires routing_api to be configured", TransportRoutingAPI)
+	}
+	if r.Type != "tcp" && r.Port == nil {
+		return fmt.Errorf("transport %s requires port", TransportRoutingAPI)
+	}
+	return nil
+}
+
+func validateTransport(transport string) error {
+	switch transport {
+	case "", TransportNATS, TransportRoutingAPI:
+		return nil
+	default:
+		return fmt.Errorf("unknown transport: %s. Supported transports: %s, %s", transport, TransportNATS, TransportRoutingAPI)
+	}
+}
+
 func parseRegistrationInterval(registrationInterval string) (time.Duration, error) {
 	var duration time.Duration
 
@@ -256,7 +603,23 @@ func parseRegistrationInterval(registrationInterval string) (time.Duration, erro
 	return duration, nil
 }
 
-func RouteFromSchema(r RouteSchema, index int, host string) (*Route, error) {
+// RouteParseOptions holds the settings of the main config that change how
+// routes are validated.
+type RouteParseOptions struct {
+	AllowUnknownOptions  bool
+	HTTP2RequiresTLSPort bool
+}
+
+// RouteParseOptions returns the options the static and dynamic routes of the
+// config are parsed with.
+func (c Config) RouteParseOptions() RouteParseOptions {
+	return RouteParseOptions{
+		AllowUnknownOptions:  c.AllowUnknownRouteOptions,
+		HTTP2RequiresTLSPort: c.HTTP2RequiresTLSPort,
+	}
+}
+
+func RouteFromSchema(r RouteSchema, index int, host string, opts RouteParseOptions) (*Route, error) {
 	errors := multierror.NewMultiError(fmt.Sprintf("route %s", nameOrIndex(r, index)))
 
 	if r.Type != "tcp" && r.Type != "sni" && r.Name == "" {
@@ -270,6 +633,14 @@ func RouteFromSchema(r RouteSchema, index int, host string) (*Route, error) {
 			r.Host = host
 		}
 	}
+	if r.Host != "" {
+		normalized, err := normalizeHost(r.Host)
+		if err != nil {
+			errors.Add(err)
+		} else {
+			r.Host = normalized
+		}
+	}
 
 	if r.Port == nil && r.TLSPort == nil && r.SniPort == nil {
 		errors.Add(fmt.Errorf("no port"))
@@ -293,10 +664,26 @@ func RouteFromSchema(r RouteSchema, index int, host string) (*Route, error) {
 			}
 		}
 
-		_, err := url.Parse(r.RouteServiceUrl)
-		if err != nil {
+		uris, uriErrors := normalizeURIs(r.URIs)
+		for _, err := range uriErrors {
 			errors.Add(err)
 		}
+		r.URIs = uris
+
+		if r.RouteServiceUrl != "" {
+			err := validateRouteServiceURL(r.RouteServiceUrl)
+			if err != nil {
+				errors.Add(err)
+			}
+		}
+
+		if r.TLSPort != nil && r.ServerCertDomainSAN == "" {
+			errors.Add(fmt.Errorf("tls_port requires server_cert_domain_san"))
+		}
+
+		if r.Protocol == "http2" && r.TLSPort == nil && opts.HTTP2RequiresTLSPort {
+			errors.Add(fmt.Errorf("protocol http2 requires tls_port"))
+		}
 	} else {
 		if r.RouterGroup == "" {
 			errors.Add(fmt.Errorf("missing router_group"))
@@ -304,6 +691,26 @@ func RouteFromSchema(r RouteSchema, index int, host string) (*Route, error) {
 		if r.ExternalPort != nil && *r.ExternalPort <= 0 {
 			errors.Add(fmt.Errorf("invalid port: %d", *r.ExternalPort))
 		}
+		if r.Type == "tcp" && r.Port == nil && (r.TLSPort != nil || r.SniPort != nil) {
+			errors.Add(fmt.Errorf("tcp routes require port"))
+		}
+		if r.Type == "sni" && r.SniPort == nil && (r.Port != nil || r.TLSPort != nil) {
+			errors.Add(fmt.Errorf("sni routes require sni_port"))
+		}
+		if r.Type == "sni" && r.SniRoutableSan == "" {
+			errors.Add(fmt.Errorf("sni routes require sni_routable_san"))
+		}
+		if r.InstanceID != "" && r.TLSPort == nil {
+			errors.Add(fmt.Errorf("instance_id requires tls_port"))
+		}
+	}
+
+	if r.Type != "tcp" && r.Type != "sni" && r.InstanceID != "" {
+		errors.Add(fmt.Errorf("instance_id is only supported for tcp and sni routes"))
+	}
+
+	if (r.Type == "tcp" || r.Type == "sni") && r.AvailabilityZone != "" {
+		errors.Add(fmt.Errorf("availability_zone is not supported for tcp and sni routes"))
 	}
 
 	if r.Protocol != "" && r.Protocol != "http1" && r.Protocol != "http2" {
@@ -311,12 +718,41 @@ func RouteFromSchema(r RouteSchema, index int, host string) (*Route, error) {
 	}
 
 	if r.Options != nil {
-		if r.Options.LoadBalancingAlgorithm != "" {
+		// Algorithms added to gorouter later are forwarded like unknown options.
+		if r.Options.LoadBalancingAlgorithm != "" && !opts.AllowUnknownOptions {
 			err := validatePerRouteLoadBalancingAlgorithm(r.Options.LoadBalancingAlgorithm)
 			if err != nil {
 				errors.Add(err)
 			}
 		}
+
+		for _, err := range validateHashOptions(r.Options) {
+			errors.Add(err)
+		}
+
+		if len(r.Options.Unknown) > 0 && !opts.AllowUnknownOptions {
+			errors.Add(fmt.Errorf(
+				"unknown options: %s. Known options: %s. Set allow_unknown_route_options to forward other options to gorouter",
+				strings.Join(sortedKeys(r.Options.Unknown), ", "),
+				strings.Join(knownRouteOptions, ", "),
+			))
+		}
+	}
+
+	if r.StaleThresholdInSeconds < 0 {
+		errors.Add(fmt.Errorf("invalid stale_threshold_in_seconds: %d", r.StaleThresholdInSeconds))
+	}
+
+	err := validateTransport(r.Transport)
+	if err != nil {
+		errors.Add(err)
+	}
+	if r.Type == "tcp" || r.Type == "sni" {
+		if r.Transport == TransportNATS {
+			errors.Add(fmt.Errorf("transport %s is not supported for %s routes", r.Transport, r.Type))
+		}
+	} else if r.Transport == TransportRoutingAPI && r.Port == nil {
+		errors.Add(fmt.Errorf("transport %s requires port", r.Transport))
 	}
 
 	registrationInterval, err := parseRegistrationInterval(r.RegistrationInterval)
@@ -337,21 +773,28 @@ func RouteFromSchema(r RouteSchema, index int, host string) (*Route, error) {
 	}
 
 	route := Route{
-		Type:                 r.Type,
-		Name:                 r.Name,
-		Host:                 r.Host,
-		Port:                 r.Port,
-		Protocol:             r.Protocol,
-		TLSPort:              r.TLSPort,
-		Tags:                 r.Tags,
-		URIs:                 r.URIs,
-		RouterGroup:          r.RouterGroup,
-		ExternalPort:         r.ExternalPort,
-		RouteServiceUrl:      r.RouteServiceUrl,
-		ServerCertDomainSAN:  r.ServerCertDomainSAN,
-		RegistrationInterval: registrationInterval,
-		HealthCheck:          healthCheck,
-		Options:              r.Options,
+		Type:                    r.Type,
+		Name:                    r.Name,
+		Host:                    r.Host,
+		Port:                    r.Port,
+		Protocol:                r.Protocol,
+		TLSPort:                 r.TLSPort,
+		Tags:                    r.Tags,
+		URIs:                    r.URIs,
+		RouterGroup:             r.RouterGroup,
+		ExternalPort:            r.ExternalPort,
+		RouteServiceUrl:         r.RouteServiceUrl,
+		ServerCertDomainSAN:     r.ServerCertDomainSAN,
+		RegistrationInterval:    registrationInterval,
+		HealthCheck:             healthCheck,
+		Options:                 r.Options,
+		App:                     r.App,
+		PrivateInstanceIndex:    r.PrivateInstanceIndex,
+		IsolationSegment:        r.IsolationSegment,
+		StaleThresholdInSeconds: r.StaleThresholdInSeconds,
+		Transport:               r.Transport,
+		InstanceID:              r.InstanceID,
+		AvailabilityZone:        r.AvailabilityZone,
 	}
 
 	if r.Type == "sni" {
@@ -362,13 +805,50 @@ func RouteFromSchema(r RouteSchema, index int, host string) (*Route, error) {
 	return &route, nil
 }
 
+func validateRouteServiceURL(routeServiceURL string) error {
+	u, err := url.Parse(routeServiceURL)
+	if err != nil {
+		return fmt.Errorf("invalid route_service_url %q: %s", routeServiceURL, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid route_service_url %q: must be an absolute https URL", routeServiceURL)
+	}
+	return nil
+}
+
 func validatePerRouteLoadBalancingAlgorithm(loadBalancingAlgo LoadBalancingAlgorithm) error {
 	for _, lbAlgo := range supportedLoadBalancingAlgorithms {
 		if loadBalancingAlgo == lbAlgo {
 			return nil
 		}
 	}
-	return fmt.Errorf("unknown load balancing algorithm: %s. Allowed values: %s", loadBalancingAlgo, supportedLoadBalancingAlgorithms)
+	return fmt.Errorf("unknown load balancing algorithm: %s. Allowed values: %s. Set allow_unknown_route_options to forward other algorithms to gorouter", loadBalancingAlgo, supportedLoadBalancingAlgorithms)
+}
+
+func validateHashOptions(options *Options) []error {
+	var errs []error
+
+	if options.LoadBalancingAlgorithm != Hash {
+		if options.HashHeader != "" {
+			errs = append(errs, fmt.Errorf("hash_header requires loadbalancing %s", Hash))
+		}
+		if options.HashBalance != 0 {
+			errs = append(errs, fmt.Errorf("hash_balance requires loadbalancing %s", Hash))
+		}
+		return errs
+	}
+
+	if options.HashHeader == "" {
+		errs = append(errs, fmt.Errorf("loadbalancing %s requires hash_header", Hash))
+	} else if !httpHeaderNameRegexp.MatchString(options.HashHeader) {
+		errs = append(errs, fmt.Errorf("invalid hash_header: %q is not a valid HTTP header name", options.HashHeader))
+	}
+
+	if options.HashBalance != 0 && (options.HashBalance < minHashBalance || options.HashBalance > maxHashBalance) {
+		errs = append(errs, fmt.Errorf("invalid hash_balance: %v must be 0 or between %v and %v", options.HashBalance, minHashBalance, maxHashBalance))
+	}
+
+	return errs
 }
 
 func healthCheckFromSchema(
@@ -436,7 +916,7 @@ func messageBusServersFromSchema(servers []MessageBusServerSchema) ([]MessageBus
 	for _, m := range servers {
 		messageBusServers = append(
 			messageBusServers,
-			MessageBusServer(m),
+			MessageBusServer{Host: m.Host, User: m.User, Password: m.Password},
 		)
 	}
 
@@ -487,6 +967,17 @@ func routingAPIFromSchema(api RoutingAPISchema) (*RoutingAPI, error) {
 
 	maxTTL := parseMaxTTL(api.MaxTTL)
 
+	var batchWindow time.Duration
+	if api.BatchWindow != "" {
+		batchWindow, err = time.ParseDuration(api.BatchWindow)
+		if err != nil {
+			return nil, fmt.Errorf("routing_api has an invalid batch_window: %s", err)
+		}
+		if batchWindow < 0 {
+			return nil, fmt.Errorf("routing_api batch_window must not be negative: %s", api.BatchWindow)
+		}
+	}
+
 	return &RoutingAPI{
 		APIURL:                  api.APIURL,
 		OAuthURL:                api.OAuthURL,
@@ -498,6 +989,10 @@ func routingAPIFromSchema(api RoutingAPISchema) (*RoutingAPI, error) {
 		ClientPrivateKeyPath:    api.ClientPrivateKeyPath,
 		ServerCACertificatePath: api.ServerCACertificatePath,
 		MaxTTL:                  maxTTL,
+		BatchWindow:             batchWindow,
+		ReconcileStaleTCPRoutes: api.ReconcileStaleTCPRoutes,
+		ReconcileDryRun:         api.ReconcileDryRun,
+		WatchTCPRouteEvents:     api.WatchTCPRouteEvents,
 	}, nil
 }
 
@@ -1,8 +1,12 @@
 package config_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/route-registrar/config"
@@ -146,6 +150,181 @@ var _ = Describe("Config", func() {
 			Expect(cfg).To(Equal(configSchema))
 		})
 
+		It("returns a valid config from YAML", func() {
+			cfg_file := "../example_config/example.yml"
+			cfg, err := config.NewConfigSchemaFromFile(cfg_file)
+			Expect(err).NotTo(HaveOccurred())
+
+			strict := true
+			configSchema.StrictConfig = &strict
+			Expect(cfg).To(Equal(configSchema))
+		})
+
+		Context("when the format is detected from the content", func() {
+			var dir string
+
+			BeforeEach(func() {
+				dir = GinkgoT().TempDir()
+			})
+
+			It("detects JSON", func() {
+				b, err := os.ReadFile("../example_config/example.json")
+				Expect(err).NotTo(HaveOccurred())
+				cfg_file := filepath.Join(dir, "registrar_settings")
+				Expect(os.WriteFile(cfg_file, append([]byte("\n  "), b...), 0644)).To(Succeed())
+
+				cfg, err := config.NewConfigSchemaFromFile(cfg_file)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cfg).To(Equal(configSchema))
+			})
+
+			It("parses JSON in a .yml file as JSON", func() {
+				b, err := os.ReadFile("../example_config/example.json")
+				Expect(err).NotTo(HaveOccurred())
+				cfg_file := filepath.Join(dir, "registrar_settings.yml")
+				Expect(os.WriteFile(cfg_file, b, 0644)).To(Succeed())
+
+				cfg, err := config.NewConfigSchemaFromFile(cfg_file)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cfg).To(Equal(configSchema))
+			})
+
+			Context("when a .yml file starting with { is neither JSON nor YAML", func() {
+				It("reports both errors", func() {
+					cfg_file := filepath.Join(dir, "registrar_settings.yml")
+					Expect(os.WriteFile(cfg_file, []byte(`{"host": "127.0.0.1",, }`), 0644)).To(Succeed())
+
+					_, err := config.NewConfigSchemaFromFile(cfg_file)
+					Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("failed to parse %s as JSON: invalid character ','", cfg_file))))
+					Expect(err).To(MatchError(ContainSubstring("; as YAML: yaml:")))
+				})
+			})
+
+			It("detects YAML", func() {
+				b, err := os.ReadFile("../example_config/example.yml")
+				Expect(err).NotTo(HaveOccurred())
+				cfg_file := filepath.Join(dir, "registrar_settings.conf")
+				Expect(os.WriteFile(cfg_file, b, 0644)).To(Succeed())
+
+				cfg, err := config.NewConfigSchemaFromFile(cfg_file)
+				Expect(err).NotTo(HaveOccurred())
+
+				strict := true
+				configSchema.StrictConfig = &strict
+				Expect(cfg).To(Equal(configSchema))
+			})
+		})
+
+		Context("when a YAML config is invalid", func() {
+			It("reports the same validation errors as for JSON", func() {
+				dir := GinkgoT().TempDir()
+				jsonFile := filepath.Join(dir, "config.json")
+				yamlFile := filepath.Join(dir, "config.yml")
+				Expect(os.WriteFile(jsonFile, []byte(`{"routes": [{"name": "route", "registration_interval": "-5s"}]}`), 0644)).To(Succeed())
+				Expect(os.WriteFile(yamlFile, []byte("routes:\n- name: route\n  registration_interval: -5s\n"), 0644)).To(Succeed())
+
+				jsonSchema, err := config.NewConfigSchemaFromFile(jsonFile)
+				Expect(err).NotTo(HaveOccurred())
+				yamlSchema, err := config.NewConfigSchemaFromFile(yamlFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, jsonErr := jsonSchema.ParseSchemaAndSetDefaultsToConfig()
+				_, yamlErr := yamlSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(jsonErr).To(HaveOccurred())
+				Expect(yamlErr).To(MatchError(jsonErr.Error()))
+			})
+		})
+
+		Context("when the config has unknown fields", func() {
+			var dir string
+
+			BeforeEach(func() {
+				dir = GinkgoT().TempDir()
+			})
+
+			writeConfig := func(name, contents string) string {
+				cfg_file := filepath.Join(dir, name)
+				Expect(os.WriteFile(cfg_file, []byte(contents), 0644)).To(Succeed())
+				return cfg_file
+			}
+
+			It("reports them with the file, route and a suggested spelling", func() {
+				cfg_file := writeConfig("config.yml", `
+hots: 127.0.0.1
+routes:
+- name: my-route
+  port: 8080
+  uris: [my-app.example.com]
+  registraton_interval: 10s
+  health_check:
+    name: check
+    script_path: /check
+    timeuot: 1s
+  options:
+    some_gorouter_option: value
+- port: 8081
+  xyz: true
+`)
+				_, err := config.NewConfigSchemaFromFile(cfg_file)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(cfg_file))
+				Expect(err.Error()).To(ContainSubstring(`unknown field "hots", did you mean "host"?`))
+				Expect(err.Error()).To(ContainSubstring(`unknown field "registraton_interval" in routes[0] (route "my-route"), did you mean "registration_interval"?`))
+				Expect(err.Error()).To(ContainSubstring(`unknown field "timeuot" in routes[0].health_check (route "my-route"), did you mean "timeout"?`))
+				Expect(err.Error()).To(ContainSubstring(`unknown field "xyz" in routes[1]`))
+				Expect(err.Error()).NotTo(ContainSubstring("some_gorouter_option"))
+			})
+
+			It("returns the parsed schema with the error", func() {
+				cfg_file := writeConfig("config.yml", "strict_config: true\nhots: 127.0.0.1\nhost: 10.0.0.1\n")
+				cfg, err := config.NewConfigSchemaFromFile(cfg_file)
+				Expect(err).To(MatchError(ContainSubstring(`unknown field "hots"`)))
+				Expect(cfg.Host).To(Equal("10.0.0.1"))
+			})
+
+			It("reports them in JSON configs", func() {
+				cfg_file := writeConfig("config.json", `{"strict_config": true, "host": "127.0.0.1", "message_bus_servers": [{"host": "nats", "pasword": "secret"}]}`)
+				_, err := config.NewConfigSchemaFromFile(cfg_file)
+				Expect(err).To(MatchError(ContainSubstring(`unknown field "pasword" in message_bus_servers[0], did you mean "password"?`)))
+			})
+
+			Context("when strict_config is not set", func() {
+				It("reports them in YAML configs, which are strict by default", func() {
+					cfg_file := writeConfig("config.yml", "hots: 127.0.0.1\n")
+					cfg, err := config.NewConfigSchemaFromFile(cfg_file)
+					Expect(err).To(MatchError(ContainSubstring(`unknown field "hots", did you mean "host"?`)))
+					Expect(*cfg.StrictConfig).To(BeTrue())
+				})
+
+				It("ignores them in JSON configs, as older versions did", func() {
+					cfg_file := writeConfig("config.json", `{"hots": "127.0.0.1"}`)
+					cfg, err := config.NewConfigSchemaFromFile(cfg_file)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(cfg.StrictConfig).To(BeNil())
+
+					c, err := cfg.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.StrictConfig).To(BeFalse())
+				})
+
+				It("ignores them in .yml configs rendered as JSON", func() {
+					cfg_file := writeConfig("registrar_settings.yml", `{"hots": "127.0.0.1"}`)
+					cfg, err := config.NewConfigSchemaFromFile(cfg_file)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(cfg.StrictConfig).To(BeNil())
+				})
+			})
+
+			Context("when strict_config is false", func() {
+				It("ignores them", func() {
+					cfg_file := writeConfig("config.yml", "strict_config: false\nhots: 127.0.0.1\n")
+					cfg, err := config.NewConfigSchemaFromFile(cfg_file)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(*cfg.StrictConfig).To(BeFalse())
+				})
+			})
+		})
+
 		Context("when the file does not exists", func() {
 			It("returns an error", func() {
 				cfg_file := "notexist"
@@ -338,6 +517,9 @@ var _ = Describe("Config", func() {
 				},
 				AvailabilityZone:           "some-zone",
 				UnregistrationMessageLimit: 5,
+				Transport:                  "nats",
+				CertificateReloadInterval:  time.Minute,
+				CertificateExpiryWarning:   30 * 24 * time.Hour,
 			}
 
 			Expect(c).To(Equal(expectedC))
@@ -376,6 +558,33 @@ var _ = Describe("Config", func() {
 		})
 
 		Describe("Routes", func() {
+			Context("when two tcp routes claim the same external port", func() {
+				BeforeEach(func() {
+					otherPort := uint16(9090)
+					duplicate := configSchema.Routes[3]
+					duplicate.Port = &otherPort
+					configSchema.Routes = append(configSchema.Routes, duplicate)
+				})
+
+				It("returns an error", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`conflicts with route for external_port %d in the main config: both claim external_port %d of router group "some-router-group"`, tcpPort0, tcpPort0))))
+				})
+			})
+
+			Context("when two sni routes share an external port", func() {
+				BeforeEach(func() {
+					other := configSchema.Routes[4]
+					other.SniRoutableSan = "other-sni.internal"
+					configSchema.Routes = append(configSchema.Routes, other)
+				})
+
+				It("accepts them for different SANs", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
 			Context("when route has host", func() {
 				BeforeEach(func() {
 					configSchema.Routes[0].Host = "some-route-host"
@@ -451,6 +660,16 @@ var _ = Describe("Config", func() {
 						Expect(err).To(HaveOccurred())
 					})
 				})
+
+				Context("and the route_service_url is not an absolute https URL", func() {
+					It("returns an error", func() {
+						for _, routeServiceURL := range []string{"http://rs.example.com", "rs.example.com", "/some/path", "https:///some/path"} {
+							configSchema.Routes[0].RouteServiceUrl = routeServiceURL
+							_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+							Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("invalid route_service_url %q: must be an absolute https URL", routeServiceURL))))
+						}
+					})
+				})
 			})
 
 			Context("when config input includes per route options", func() {
@@ -486,6 +705,127 @@ var _ = Describe("Config", func() {
 					It("returns an error", func() {
 						_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
 						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring("unknown load balancing algorithm: unknown-algorithm"))
+					})
+
+					Context("and allow_unknown_route_options is set", func() {
+						BeforeEach(func() {
+							configSchema.AllowUnknownRouteOptions = true
+						})
+
+						It("forwards the algorithm verbatim", func() {
+							c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+							Expect(err).ToNot(HaveOccurred())
+
+							Expect(c.Routes[0].Options.LoadBalancingAlgorithm).To(Equal(config.LoadBalancingAlgorithm("unknown-algorithm")))
+						})
+					})
+				})
+
+				Context("and has the hash load balancing algorithm", func() {
+					BeforeEach(func() {
+						configSchema.Routes[0].Options.LoadBalancingAlgorithm = config.Hash
+						configSchema.Routes[0].Options.HashHeader = "X-Tenant-ID"
+						configSchema.Routes[0].Options.HashBalance = 1.25
+					})
+
+					It("includes the hash options in the config", func() {
+						c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(c.Routes[0].Options.LoadBalancingAlgorithm).To(Equal(config.Hash))
+						Expect(c.Routes[0].Options.HashHeader).To(Equal("X-Tenant-ID"))
+						Expect(c.Routes[0].Options.HashBalance).To(Equal(1.25))
+					})
+
+					Context("when the hash_balance is not set", func() {
+						BeforeEach(func() {
+							configSchema.Routes[0].Options.HashBalance = 0
+						})
+
+						It("returns no error", func() {
+							_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+							Expect(err).ToNot(HaveOccurred())
+						})
+					})
+
+					Context("when the hash_header is missing", func() {
+						BeforeEach(func() {
+							configSchema.Routes[0].Options.HashHeader = ""
+						})
+
+						It("returns an error", func() {
+							_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+							Expect(err).To(HaveOccurred())
+							Expect(err.Error()).To(ContainSubstring("loadbalancing hash requires hash_header"))
+						})
+					})
+
+					Context("when the hash_header is not a valid header name", func() {
+						BeforeEach(func() {
+							configSchema.Routes[0].Options.HashHeader = "X Tenant:ID"
+						})
+
+						It("returns an error", func() {
+							_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+							Expect(err).To(HaveOccurred())
+							Expect(err.Error()).To(ContainSubstring(`invalid hash_header: "X Tenant:ID" is not a valid HTTP header name`))
+						})
+					})
+
+					Context("when the hash_balance is out of range", func() {
+						BeforeEach(func() {
+							configSchema.Routes[0].Options.HashBalance = 1.05
+						})
+
+						It("returns an error", func() {
+							_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+							Expect(err).To(HaveOccurred())
+							Expect(err.Error()).To(ContainSubstring("invalid hash_balance: 1.05 must be 0 or between 1.1 and 10"))
+						})
+					})
+				})
+
+				Context("and has hash options without the hash load balancing algorithm", func() {
+					BeforeEach(func() {
+						configSchema.Routes[0].Options.LoadBalancingAlgorithm = config.RoundRobin
+						configSchema.Routes[0].Options.HashHeader = "X-Tenant-ID"
+						configSchema.Routes[0].Options.HashBalance = 1.25
+					})
+
+					It("returns an error", func() {
+						_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring("hash_header requires loadbalancing hash"))
+						Expect(err.Error()).To(ContainSubstring("hash_balance requires loadbalancing hash"))
+					})
+				})
+
+				Context("and has options unknown to route-registrar", func() {
+					BeforeEach(func() {
+						configSchema.Routes[0].Options.Unknown = map[string]string{"some_new_option": "some-value"}
+					})
+
+					It("returns an error", func() {
+						_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring(`route "route-0"`))
+						Expect(err.Error()).To(ContainSubstring("unknown options: some_new_option"))
+						Expect(err.Error()).To(ContainSubstring("allow_unknown_route_options"))
+					})
+
+					Context("and allow_unknown_route_options is set", func() {
+						BeforeEach(func() {
+							configSchema.AllowUnknownRouteOptions = true
+						})
+
+						It("includes them in the config", func() {
+							c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+							Expect(err).ToNot(HaveOccurred())
+
+							Expect(c.AllowUnknownRouteOptions).To(BeTrue())
+							Expect(c.Routes[0].Options.Unknown).To(Equal(map[string]string{"some_new_option": "some-value"}))
+						})
 					})
 				})
 			})
@@ -505,6 +845,38 @@ var _ = Describe("Config", func() {
 				})
 			})
 
+			Context("when the config input includes gorouter metadata", func() {
+				BeforeEach(func() {
+					configSchema.Routes[0].App = "some-app-guid"
+					configSchema.Routes[0].PrivateInstanceIndex = "2"
+					configSchema.Routes[0].IsolationSegment = "some-iso-seg"
+					configSchema.Routes[0].StaleThresholdInSeconds = 120
+				})
+
+				It("includes it in the config", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(c.Routes[0].App).Should(Equal("some-app-guid"))
+					Expect(c.Routes[0].PrivateInstanceIndex).Should(Equal("2"))
+					Expect(c.Routes[0].IsolationSegment).Should(Equal("some-iso-seg"))
+					Expect(c.Routes[0].StaleThresholdInSeconds).Should(Equal(120))
+				})
+
+				Context("and the stale_threshold_in_seconds is negative", func() {
+					BeforeEach(func() {
+						configSchema.Routes[0].StaleThresholdInSeconds = -1
+					})
+
+					It("returns an error", func() {
+						_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring(`route "route-0"`))
+						Expect(err.Error()).To(ContainSubstring("invalid stale_threshold_in_seconds: -1"))
+					})
+				})
+			})
+
 			Context("healthcheck is provided", func() {
 				BeforeEach(func() {
 					configSchema.Routes[0].HealthCheck = &config.HealthCheckSchema{
@@ -547,6 +919,158 @@ var _ = Describe("Config", func() {
 					})
 				})
 			})
+
+			Context("when the route contains templates", func() {
+				BeforeEach(func() {
+					os.Setenv("ROUTE_REGISTRAR_TEST_DEPLOYMENT", "cf")
+					os.Setenv("ROUTE_REGISTRAR_TEST_SECRET", "secret")
+					configSchema.TemplateEnv = []string{"ROUTE_REGISTRAR_TEST_DEPLOYMENT", "ROUTE_REGISTRAR_TEST_UNSET"}
+					configSchema.Deployment = "my-deployment"
+					configSchema.InstanceID = "my-instance-id"
+					configSchema.RouteDefaults.Tags = map[string]string{"az": "{{.AvailabilityZone}}"}
+					configSchema.Routes[0].Name = "route-{{.Env.ROUTE_REGISTRAR_TEST_DEPLOYMENT}}"
+					configSchema.Routes[0].URIs = []string{"{{.Hostname}}.my-domain.com"}
+					configSchema.Routes[0].Tags = map[string]string{
+						"deployment":  "{{.Deployment}}",
+						"instance_id": "{{.InstanceID}}",
+						"host":        "{{.Host}}",
+						"hostname":    "{{.Hostname}}",
+						"env":         "{{.Env.ROUTE_REGISTRAR_TEST_DEPLOYMENT}}",
+					}
+				})
+
+				AfterEach(func() {
+					os.Unsetenv("ROUTE_REGISTRAR_TEST_DEPLOYMENT")
+					os.Unsetenv("ROUTE_REGISTRAR_TEST_SECRET")
+				})
+
+				It("expands them in the name, uris and tags", func() {
+					hostname, err := os.Hostname()
+					Expect(err).NotTo(HaveOccurred())
+
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.Routes[0].Name).To(Equal("route-cf"))
+					Expect(c.Routes[0].URIs).To(Equal([]string{strings.ToLower(hostname) + ".my-domain.com"}))
+					Expect(c.Routes[0].Tags).To(Equal(map[string]string{
+						"az":          "some-zone",
+						"deployment":  "my-deployment",
+						"instance_id": "my-instance-id",
+						"host":        "127.0.0.1",
+						"hostname":    hostname,
+						"env":         "cf",
+					}))
+					Expect(c.Routes[1].Tags).To(Equal(map[string]string{"az": "some-zone"}))
+				})
+
+				It("does not expose environment variables that are not listed in template_env", func() {
+					configSchema.Routes[0].Tags["secret"] = "{{.Env.ROUTE_REGISTRAR_TEST_SECRET}}"
+					configSchema.Routes[1].Tags = map[string]string{"env": "{{range $k, $v := .Env}}{{$k}}={{$v}};{{end}}"}
+
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(MatchError(ContainSubstring(`invalid template in tags.secret:`)))
+					Expect(err).To(MatchError(ContainSubstring(`map has no entry for key "ROUTE_REGISTRAR_TEST_SECRET"`)))
+
+					configSchema.Routes[0].Tags["secret"] = ""
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.Routes[1].Tags["env"]).To(Equal("ROUTE_REGISTRAR_TEST_DEPLOYMENT=cf;"))
+				})
+
+				It("does not modify the schema", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(configSchema.Routes[0].Name).To(Equal("route-{{.Env.ROUTE_REGISTRAR_TEST_DEPLOYMENT}}"))
+				})
+
+				It("returns an error for unset environment variables and invalid templates", func() {
+					configSchema.Routes[0].Tags["deployment"] = "{{.Env.ROUTE_REGISTRAR_TEST_UNSET}}"
+					configSchema.Routes[0].URIs = []string{"{{.Hostname"}
+
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(MatchError(ContainSubstring(`invalid template in tags.deployment:`)))
+					Expect(err).To(MatchError(ContainSubstring(`map has no entry for key "ROUTE_REGISTRAR_TEST_UNSET"`)))
+					Expect(err).To(MatchError(ContainSubstring(`invalid template in uris[0]:`)))
+				})
+			})
+
+			Context("when route defaults are set", func() {
+				BeforeEach(func() {
+					configSchema.RouteDefaults = config.RouteDefaultsSchema{
+						RegistrationInterval: "30s",
+						Tags:                 map[string]string{"team": "routing", "component": "default"},
+						HealthCheck: &config.HealthCheckSchema{
+							Name:       "default-check",
+							ScriptPath: "/path/to/default-check",
+						},
+						RouterGroup: "default-router-group",
+						Options: &config.Options{
+							LoadBalancingAlgorithm: config.RoundRobin,
+						},
+					}
+					configSchema.Routes[0].RegistrationInterval = ""
+					configSchema.Routes[0].Tags = map[string]string{"component": "route-0"}
+					configSchema.Routes[3].RouterGroup = ""
+				})
+
+				It("fills in the fields a route does not set", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(c.Routes[0].RegistrationInterval).To(Equal(30 * time.Second))
+					Expect(c.Routes[0].HealthCheck.Name).To(Equal("default-check"))
+					Expect(c.Routes[0].HealthCheck.ScriptPath).To(Equal("/path/to/default-check"))
+					Expect(c.Routes[0].Options.LoadBalancingAlgorithm).To(Equal(config.RoundRobin))
+					Expect(c.Routes[3].RouterGroup).To(Equal("default-router-group"))
+				})
+
+				It("keeps the fields a route sets", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(c.Routes[1].RegistrationInterval).To(Equal(registrationInterval1))
+					Expect(c.Routes[1].Options.LoadBalancingAlgorithm).To(Equal(config.LeastConns))
+					Expect(c.Routes[4].RouterGroup).To(Equal("some-router-group"))
+				})
+
+				It("replaces the default options with the options a route sets", func() {
+					configSchema.RouteDefaults.Options = &config.Options{
+						LoadBalancingAlgorithm: config.Hash,
+						HashHeader:             "X-Tenant",
+					}
+
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(c.Routes[0].Options.LoadBalancingAlgorithm).To(Equal(config.Hash))
+					Expect(c.Routes[0].Options.HashHeader).To(Equal("X-Tenant"))
+					Expect(c.Routes[1].Options.LoadBalancingAlgorithm).To(Equal(config.LeastConns))
+					Expect(c.Routes[1].Options.HashHeader).To(BeEmpty())
+				})
+
+				It("merges tags key by key", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(c.Routes[0].Tags).To(Equal(map[string]string{"team": "routing", "component": "route-0"}))
+					Expect(c.Routes[1].Tags).To(Equal(map[string]string{"team": "routing", "component": "default"}))
+				})
+
+				It("does not set a router group on http routes", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(c.Routes[0].RouterGroup).To(BeEmpty())
+				})
+
+				It("does not modify the schema", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(configSchema.Routes[0].Tags).To(Equal(map[string]string{"component": "route-0"}))
+					Expect(configSchema.Routes[1].Options.LoadBalancingAlgorithm).To(Equal(config.LeastConns))
+				})
+			})
 		})
 	})
 
@@ -766,21 +1290,84 @@ var _ = Describe("Config", func() {
 					Expect(err.Error()).To(ContainSubstring("unknown protocol"))
 				})
 			})
-		})
 
-		Describe("on route URIs", func() {
-			Context("when the URIs are not provided", func() {
+			Context("when an http2 route has no tls_port", func() {
 				BeforeEach(func() {
-					configSchema.Routes[0].URIs = nil
+					configSchema.Routes[0].Protocol = protocolH2
 				})
 
-				It("returns an error", func() {
-					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
-					Expect(c).To(BeNil())
-					Expect(err).To(HaveOccurred())
-					Expect(err.Error()).To(ContainSubstring(`error with 'route "route-0"'`))
-					Expect(err.Error()).To(ContainSubstring("* no URIs"))
-				})
+				It("accepts it", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				Context("and http2_requires_tls_port is set", func() {
+					BeforeEach(func() {
+						configSchema.HTTP2RequiresTLSPort = true
+					})
+
+					It("returns an error", func() {
+						c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(c).To(BeNil())
+						Expect(err).To(MatchError(ContainSubstring(`error with 'route "route-0"'`)))
+						Expect(err).To(MatchError(ContainSubstring("protocol http2 requires tls_port")))
+					})
+
+					It("accepts http2 routes with a tls_port", func() {
+						tlsPort := uint16(8443)
+						configSchema.Routes[0].TLSPort = &tlsPort
+						configSchema.Routes[0].ServerCertDomainSAN = "route-0.internal"
+
+						c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(err).ToNot(HaveOccurred())
+						Expect(c.HTTP2RequiresTLSPort).To(BeTrue())
+						Expect(c.Routes[0].Protocol).To(Equal(protocolH2))
+						Expect(*c.Routes[0].TLSPort).To(Equal(tlsPort))
+					})
+				})
+			})
+		})
+
+		Describe("on route TLS fields", func() {
+			Context("when a route has a tls_port without server_cert_domain_san", func() {
+				BeforeEach(func() {
+					configSchema.Routes[1].ServerCertDomainSAN = ""
+				})
+
+				It("returns an error", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(c).To(BeNil())
+					Expect(err).To(MatchError(ContainSubstring(`error with 'route "route-1"'`)))
+					Expect(err).To(MatchError(ContainSubstring("tls_port requires server_cert_domain_san")))
+				})
+			})
+
+			Context("when an sni route has no sni_routable_san", func() {
+				BeforeEach(func() {
+					configSchema.Routes[4].SniRoutableSan = ""
+				})
+
+				It("returns an error", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(c).To(BeNil())
+					Expect(err).To(MatchError(ContainSubstring("sni routes require sni_routable_san")))
+				})
+			})
+		})
+
+		Describe("on route URIs", func() {
+			Context("when the URIs are not provided", func() {
+				BeforeEach(func() {
+					configSchema.Routes[0].URIs = nil
+				})
+
+				It("returns an error", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(c).To(BeNil())
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring(`error with 'route "route-0"'`))
+					Expect(err.Error()).To(ContainSubstring("* no URIs"))
+				})
 			})
 
 			Context("when the URIs are empty", func() {
@@ -810,6 +1397,62 @@ var _ = Describe("Config", func() {
 					Expect(err.Error()).To(ContainSubstring("* empty URIs"))
 				})
 			})
+
+			Context("when the URIs are valid", func() {
+				BeforeEach(func() {
+					configSchema.Routes[0].URIs = []string{
+						"My-App.Example.COM",
+						"*.apps.example.com",
+						"my-app.example.com/some/Path",
+						"localhost",
+					}
+				})
+
+				It("lowercases their hostnames", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.Routes[0].URIs).To(Equal([]string{
+						"my-app.example.com",
+						"*.apps.example.com",
+						"my-app.example.com/some/Path",
+						"localhost",
+					}))
+				})
+			})
+
+			Context("when the URIs are invalid", func() {
+				BeforeEach(func() {
+					configSchema.Routes[0].URIs = []string{
+						"https://my-app.example.com",
+						"my_app.example.com",
+						"foo.*.example.com",
+						"*.com",
+						"-my-app.example.com",
+						"my-app..example.com",
+						"my-app.example.com/some path",
+						"my-app.example.com:8080",
+						strings.Repeat("a", 64) + ".example.com",
+						"/some/path",
+					}
+				})
+
+				It("reports every invalid URI", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(c).To(BeNil())
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring(`there were 10 errors with 'route "route-0"'`))
+					Expect(err.Error()).To(ContainSubstring(`* invalid URI "https://my-app.example.com": must not contain a scheme`))
+					Expect(err.Error()).To(ContainSubstring(`* invalid URI "my_app.example.com": label "my_app" contains invalid character '_'`))
+					Expect(err.Error()).To(ContainSubstring(`* invalid URI "foo.*.example.com": wildcard is only allowed as the first label`))
+					Expect(err.Error()).To(ContainSubstring(`* invalid URI "*.com": wildcard must be followed by at least two labels`))
+					Expect(err.Error()).To(ContainSubstring(`* invalid URI "-my-app.example.com": label "-my-app" must not start or end with a hyphen`))
+					Expect(err.Error()).To(ContainSubstring(`* invalid URI "my-app..example.com": hostname must not contain empty labels`))
+					Expect(err.Error()).To(ContainSubstring(`* invalid URI "my-app.example.com/some path": path must not contain ' '`))
+					Expect(err.Error()).To(ContainSubstring(`* invalid URI "my-app.example.com:8080": label "com:8080" contains invalid character ':'`))
+					Expect(err.Error()).To(ContainSubstring("is longer than 63 characters"))
+					Expect(err.Error()).To(ContainSubstring(`* invalid URI "/some/path": missing hostname`))
+				})
+			})
 		})
 
 		Describe("on the healthcheck, assuming healthcheck is provided", func() {
@@ -969,19 +1612,426 @@ var _ = Describe("Config", func() {
 				})
 			})
 
-			Context("When the healthcheck timeout is not parsable", func() {
-				BeforeEach(func() {
-					configSchema.Routes[0].HealthCheck.Timeout = "asdf"
-				})
+			Context("When the healthcheck timeout is not parsable", func() {
+				BeforeEach(func() {
+					configSchema.Routes[0].HealthCheck.Timeout = "asdf"
+				})
+
+				It("returns an error", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(c).To(BeNil())
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring(`error with 'route "route-0"'`))
+					Expect(err.Error()).To(ContainSubstring("error with 'healthcheck'"))
+					Expect(err.Error()).To(ContainSubstring("invalid healthcheck timeout: time: invalid duration"))
+				})
+			})
+		})
+
+		Describe("on secrets", func() {
+			var dir string
+
+			BeforeEach(func() {
+				dir = GinkgoT().TempDir()
+				os.Setenv("ROUTE_REGISTRAR_TEST_PASSWORD", "env-password")
+				DeferCleanup(os.Unsetenv, "ROUTE_REGISTRAR_TEST_PASSWORD")
+			})
+
+			It("expands environment variable references", func() {
+				configSchema.MessageBusServers[0].Password = "${ROUTE_REGISTRAR_TEST_PASSWORD}"
+				configSchema.RoutingAPI.ClientSecret = "prefix-${ROUTE_REGISTRAR_TEST_PASSWORD}-$suffix"
+
+				c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.MessageBusServers[0].Password).To(Equal("env-password"))
+				Expect(c.RoutingAPI.ClientSecret).To(Equal("prefix-env-password-$suffix"))
+				Expect(configSchema.MessageBusServers[0].Password).To(Equal("${ROUTE_REGISTRAR_TEST_PASSWORD}"))
+			})
+
+			It("reads password_file and client_secret_file", func() {
+				passwordFile := filepath.Join(dir, "password")
+				Expect(os.WriteFile(passwordFile, []byte("file-password\n"), 0600)).To(Succeed())
+				secretFile := filepath.Join(dir, "secret")
+				Expect(os.WriteFile(secretFile, []byte("file-secret"), 0600)).To(Succeed())
+
+				configSchema.MessageBusServers[1].Password = ""
+				configSchema.MessageBusServers[1].PasswordFile = passwordFile
+				configSchema.RoutingAPI.ClientSecret = ""
+				configSchema.RoutingAPI.ClientSecretFile = secretFile
+
+				c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.MessageBusServers[1].Password).To(Equal("file-password"))
+				Expect(c.RoutingAPI.ClientSecret).To(Equal("file-secret"))
+			})
+
+			Context("when a referenced environment variable is not set", func() {
+				BeforeEach(func() {
+					configSchema.MessageBusServers[0].Password = "${ROUTE_REGISTRAR_TEST_UNSET}"
+				})
+
+				It("returns an error", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(MatchError(ContainSubstring("message_bus_servers[0].password references unset environment variable ROUTE_REGISTRAR_TEST_UNSET")))
+				})
+			})
+
+			Context("when a referenced file does not exist", func() {
+				BeforeEach(func() {
+					configSchema.RoutingAPI.ClientSecret = ""
+					configSchema.RoutingAPI.ClientSecretFile = filepath.Join(dir, "missing")
+				})
+
+				It("returns an error", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(MatchError(ContainSubstring("routing_api: failed to read client_secret_file")))
+				})
+			})
+
+			Context("when both password and password_file are set", func() {
+				BeforeEach(func() {
+					configSchema.MessageBusServers[0].PasswordFile = filepath.Join(dir, "password")
+				})
+
+				It("returns an error", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(MatchError(ContainSubstring("message_bus_servers[0]: password and password_file are mutually exclusive")))
+				})
+			})
+		})
+
+		Describe("on the certificate reload settings", func() {
+			Context("when they are set", func() {
+				BeforeEach(func() {
+					configSchema.CertificateReloadInterval = "30s"
+					configSchema.CertificateExpiryWarning = "24h"
+				})
+
+				It("parses them", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.CertificateReloadInterval).To(Equal(30 * time.Second))
+					Expect(c.CertificateExpiryWarning).To(Equal(24 * time.Hour))
+				})
+			})
+
+			Context("when the reload interval is 0", func() {
+				BeforeEach(func() {
+					configSchema.CertificateReloadInterval = "0s"
+				})
+
+				It("disables reloading", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.CertificateReloadInterval).To(BeZero())
+				})
+			})
+
+			Context("when the reload interval is not parsable", func() {
+				BeforeEach(func() {
+					configSchema.CertificateReloadInterval = "often"
+				})
+
+				It("returns an error", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(MatchError(ContainSubstring("invalid certificate_reload_interval")))
+				})
+			})
+
+			Context("when the expiry warning is negative", func() {
+				BeforeEach(func() {
+					configSchema.CertificateExpiryWarning = "-1h"
+				})
+
+				It("returns an error", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(MatchError(ContainSubstring("certificate_expiry_warning must not be negative: -1h")))
+				})
+			})
+		})
+
+		Describe("on the debug address", func() {
+			Context("when it is set", func() {
+				BeforeEach(func() {
+					configSchema.DebugAddress = "127.0.0.1:17002"
+				})
+
+				It("parses it", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.DebugAddress).To(Equal("127.0.0.1:17002"))
+				})
+			})
+
+			Context("when it has no port", func() {
+				BeforeEach(func() {
+					configSchema.DebugAddress = "127.0.0.1"
+				})
+
+				It("returns an error", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(MatchError(ContainSubstring("invalid debug_address")))
+				})
+			})
+		})
+
+		Describe("on the transport", func() {
+			Context("when the transport is unknown", func() {
+				BeforeEach(func() {
+					configSchema.Transport = "carrier-pigeon"
+				})
+
+				It("returns an error", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(c).To(BeNil())
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("unknown transport: carrier-pigeon. Supported transports: nats, routing_api"))
+				})
+			})
+
+			Context("when the transport is routing_api", func() {
+				BeforeEach(func() {
+					configSchema.Transport = "routing_api"
+					configSchema.Routes = []config.RouteSchema{configSchema.Routes[0], configSchema.Routes[2]}
+				})
+
+				It("sets the transport", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.Transport).To(Equal("routing_api"))
+				})
+
+				Context("when message bus servers are empty", func() {
+					BeforeEach(func() {
+						configSchema.MessageBusServers = []config.MessageBusServerSchema{}
+					})
+
+					It("returns no error", func() {
+						c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(c).NotTo(BeNil())
+					})
+				})
+
+				Context("when routing api is missing", func() {
+					BeforeEach(func() {
+						configSchema.RoutingAPI = config.RoutingAPISchema{}
+					})
+
+					It("returns an error", func() {
+						c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(c).To(BeNil())
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring("routing_api must have an api_url"))
+					})
+
+					It("returns an error when there are only dynamic routes", func() {
+						configSchema.Routes = nil
+						configSchema.DynamicConfigGlobs = []string{"/some/config/*/path1"}
+
+						c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(c).To(BeNil())
+						Expect(err).To(MatchError(ContainSubstring("routing_api must have an api_url")))
+					})
+				})
+
+				Context("when a route overrides it with nats", func() {
+					BeforeEach(func() {
+						configSchema.MessageBusServers = []config.MessageBusServerSchema{}
+						configSchema.Routes[0].Transport = "nats"
+					})
+
+					It("requires message bus servers", func() {
+						c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(c).To(BeNil())
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring("message_bus_servers must have at least one entry"))
+					})
+				})
+
+				Context("when an http route has no port", func() {
+					BeforeEach(func() {
+						configSchema.Routes = append(configSchema.Routes, configSchema.Routes[0])
+						configSchema.Routes[2].Name = "tls-only"
+						configSchema.Routes[2].Port = nil
+						configSchema.Routes[2].TLSPort = &port1
+						configSchema.Routes[2].ServerCertDomainSAN = "my.internal.cert"
+					})
+
+					It("returns an error", func() {
+						c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+						Expect(c).To(BeNil())
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring(`route "tls-only": transport routing_api requires port`))
+					})
+				})
+			})
+		})
+
+		Describe("on IPv6 hosts", func() {
+			It("removes brackets and canonicalizes IPv6 hosts", func() {
+				configSchema.Host = "[0:0:0:0:0:0:0:1]"
+				configSchema.Routes[2].Host = "FD00:0::2"
+
+				c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.Host).To(Equal("::1"))
+				Expect(c.Routes[0].Host).To(Equal("::1"))
+				Expect(c.Routes[2].Host).To(Equal("fd00::2"))
+			})
+
+			It("returns an error for invalid IPv6 hosts and hosts with ports", func() {
+				configSchema.Host = "[::1]:8080"
+				configSchema.Routes[2].Host = "10.0.0.1:8080"
+
+				_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).To(MatchError(ContainSubstring(`invalid host "[::1]:8080": must be an IP address or hostname without port`)))
+				Expect(err).To(MatchError(ContainSubstring(`invalid host "10.0.0.1:8080": must be an IP address or hostname without port`)))
+			})
+		})
+
+		Describe("on the host detection", func() {
+			var loopback net.Interface
+
+			BeforeEach(func() {
+				configSchema.Host = ""
+
+				interfaces, err := net.Interfaces()
+				Expect(err).NotTo(HaveOccurred())
+				found := false
+				for _, i := range interfaces {
+					if i.Flags&net.FlagLoopback != 0 && i.Flags&net.FlagUp != 0 {
+						loopback = i
+						found = true
+						break
+					}
+				}
+				if !found {
+					Skip("no loopback interface is up")
+				}
+			})
+
+			It("uses the only matching address of the host_cidr", func() {
+				configSchema.HostCIDR = "127.0.0.0/8"
+
+				c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.Host).To(Equal("127.0.0.1"))
+				Expect(c.Routes[0].Host).To(Equal("127.0.0.1"))
+			})
+
+			It("uses the preferred address family of the host_interface", func() {
+				configSchema.HostInterface = loopback.Name
+				configSchema.HostIPPreference = "ipv4"
+
+				c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.Host).To(Equal("127.0.0.1"))
+			})
+
+			It("falls back to the other address family", func() {
+				configSchema.HostCIDR = "127.0.0.0/8"
+				configSchema.HostIPPreference = "ipv6"
+
+				c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.Host).To(Equal("127.0.0.1"))
+			})
+
+			It("returns an error when no address matches", func() {
+				configSchema.HostInterface = loopback.Name
+				configSchema.HostCIDR = "198.51.100.0/24"
+
+				_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`no address matches host_interface %q and host_cidr "198.51.100.0/24"`, loopback.Name))))
+			})
+
+			It("returns an error when multiple addresses match", func() {
+				configSchema.HostInterface = loopback.Name
+				addrs, err := loopback.Addrs()
+				Expect(err).NotTo(HaveOccurred())
+				hasIPv6Loopback := false
+				for _, addr := range addrs {
+					if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(net.IPv6loopback) {
+						hasIPv6Loopback = true
+					}
+				}
+				if !hasIPv6Loopback {
+					Skip("the loopback interface has no IPv6 address")
+				}
+
+				_, err = configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`multiple addresses match host_interface %q: 127.0.0.1, ::1`, loopback.Name))))
+			})
+
+			It("returns an error for an unknown interface", func() {
+				configSchema.HostInterface = "does-not-exist0"
+
+				_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).To(MatchError(ContainSubstring(`invalid host_interface "does-not-exist0"`)))
+			})
+
+			It("returns an error for an invalid host_cidr or preference", func() {
+				configSchema.HostCIDR = "10.0.0.0"
+				configSchema.HostIPPreference = "ipv5"
+
+				_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).To(MatchError(ContainSubstring("unknown host_ip_preference: ipv5")))
+
+				configSchema.HostIPPreference = ""
+				_, err = configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).To(MatchError(ContainSubstring("invalid host_cidr: invalid CIDR address: 10.0.0.0")))
+			})
+
+			It("returns an error when host is also set", func() {
+				configSchema.Host = "10.0.0.1"
+				configSchema.HostCIDR = "127.0.0.0/8"
+
+				_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).To(MatchError(ContainSubstring("host is mutually exclusive with host_interface and host_cidr")))
+			})
+
+			It("returns an error for a preference without interface or cidr", func() {
+				configSchema.Host = "10.0.0.1"
+				configSchema.HostIPPreference = "ipv6"
 
-				It("returns an error", func() {
-					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
-					Expect(c).To(BeNil())
-					Expect(err).To(HaveOccurred())
-					Expect(err.Error()).To(ContainSubstring(`error with 'route "route-0"'`))
-					Expect(err.Error()).To(ContainSubstring("error with 'healthcheck'"))
-					Expect(err.Error()).To(ContainSubstring("invalid healthcheck timeout: time: invalid duration"))
-				})
+				_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).To(MatchError(ContainSubstring("host_ip_preference requires host_interface or host_cidr")))
+			})
+		})
+
+		Describe("on the dynamic config policies", func() {
+			It("parses the policies", func() {
+				uid := uint32(1000)
+				configSchema.DynamicConfigPolicies = []config.DynamicConfigPolicySchema{{
+					Glob:          "/var/vcap/jobs/*/routes.yml",
+					OwnerUID:      &uid,
+					Domains:       []string{"Apps.Example.com"},
+					ExternalPorts: []string{"61000-61099", "62000"},
+				}}
+
+				c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.DynamicConfigPolicies).To(Equal([]config.DynamicConfigPolicy{{
+					Glob:          "/var/vcap/jobs/*/routes.yml",
+					OwnerUID:      &uid,
+					Domains:       []string{"apps.example.com"},
+					ExternalPorts: []config.PortRange{{First: 61000, Last: 61099}, {First: 62000, Last: 62000}},
+				}}))
+			})
+
+			It("returns an error for invalid policies", func() {
+				configSchema.DynamicConfigPolicies = []config.DynamicConfigPolicySchema{
+					{Domains: []string{"apps.example.com"}},
+					{Glob: "[", Domains: []string{"*.apps.example.com"}, ExternalPorts: []string{"0-10"}},
+				}
+
+				_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+				Expect(err).To(MatchError(ContainSubstring("there were 4 errors with 'dynamic_config_policies'")))
+				Expect(err).To(MatchError(ContainSubstring("policy 0: glob or owner_uid must be provided")))
+				Expect(err).To(MatchError(ContainSubstring(`policy 1: invalid glob "[": syntax error in pattern`)))
+				Expect(err).To(MatchError(ContainSubstring(`policy 1: invalid domain "*.apps.example.com"`)))
+				Expect(err).To(MatchError(ContainSubstring(`policy 1: invalid external_ports "0-10": first port must be between 1 and 65535`)))
 			})
 		})
 
@@ -1050,6 +2100,76 @@ var _ = Describe("Config", func() {
 				})
 			})
 
+			Context("when the batch_window is set", func() {
+				BeforeEach(func() {
+					configSchema.RoutingAPI.BatchWindow = "2s"
+				})
+
+				It("sets the batch window on the config", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.RoutingAPI.BatchWindow).To(Equal(2 * time.Second))
+				})
+			})
+
+			Context("when the batch_window is not set", func() {
+				It("disables batching", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.RoutingAPI.BatchWindow).To(BeZero())
+				})
+			})
+
+			Context("when watching tcp route events is enabled", func() {
+				BeforeEach(func() {
+					configSchema.RoutingAPI.WatchTCPRouteEvents = true
+				})
+
+				It("sets the option on the config", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.RoutingAPI.WatchTCPRouteEvents).To(BeTrue())
+				})
+			})
+
+			Context("when reconciliation of stale tcp routes is enabled", func() {
+				BeforeEach(func() {
+					configSchema.RoutingAPI.ReconcileStaleTCPRoutes = true
+					configSchema.RoutingAPI.ReconcileDryRun = true
+				})
+
+				It("sets the reconciliation options on the config", func() {
+					c, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.RoutingAPI.ReconcileStaleTCPRoutes).To(BeTrue())
+					Expect(c.RoutingAPI.ReconcileDryRun).To(BeTrue())
+				})
+			})
+
+			Context("when the batch_window is not parsable", func() {
+				BeforeEach(func() {
+					configSchema.RoutingAPI.BatchWindow = "asdf"
+				})
+
+				It("returns an error", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("routing_api has an invalid batch_window"))
+				})
+			})
+
+			Context("when the batch_window is negative", func() {
+				BeforeEach(func() {
+					configSchema.RoutingAPI.BatchWindow = "-1s"
+				})
+
+				It("returns an error", func() {
+					_, err := configSchema.ParseSchemaAndSetDefaultsToConfig()
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("routing_api batch_window must not be negative: -1s"))
+				})
+			})
+
 			Context("when routing api url has https scheme", func() {
 				BeforeEach(func() {
 					configSchema.RoutingAPI.APIURL = "https://api.example.com"
@@ -1295,6 +2415,122 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Describe("ValidateSchema", func() {
+		BeforeEach(func() {
+			configSchema.MessageBusServers[0].Password = "${ROUTE_REGISTRAR_TEST_UNSET}"
+			configSchema.RoutingAPI.ClientSecret = ""
+			configSchema.RoutingAPI.ClientSecretFile = "/does/not/exist"
+			configSchema.Host = ""
+			configSchema.HostInterface = "does-not-exist0"
+			configSchema.HostCIDR = "10.0.0.0/8"
+			configSchema.TemplateEnv = []string{"ROUTE_REGISTRAR_TEST_UNSET"}
+			configSchema.Routes[0].Tags = map[string]string{"team": "{{.Env.ROUTE_REGISTRAR_TEST_UNSET}}"}
+		})
+
+		It("skips what depends on the machine instead of returning errors", func() {
+			c, skipped, err := configSchema.ValidateSchema()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(skipped).To(ConsistOf(
+				"message_bus_servers[0].password: ${ROUTE_REGISTRAR_TEST_UNSET} not resolved",
+				"routing_api.client_secret_file: not read",
+				`host: not detected from host_interface "does-not-exist0" and host_cidr "10.0.0.0/8"`,
+				"template_env: ROUTE_REGISTRAR_TEST_UNSET is not set",
+			))
+			Expect(c.Routes).To(HaveLen(len(configSchema.Routes)))
+		})
+
+		It("still checks the syntax of the host detection and the secrets", func() {
+			configSchema.HostCIDR = "10.0.0.0"
+			configSchema.RoutingAPI.ClientSecret = "secret"
+
+			_, _, err := configSchema.ValidateSchema()
+			Expect(err).To(MatchError(ContainSubstring("invalid host_cidr")))
+			Expect(err).To(MatchError(ContainSubstring("routing_api: client_secret and client_secret_file are mutually exclusive")))
+		})
+
+		It("returns the valid part of the config with the errors", func() {
+			configSchema.Routes[0].RegistrationInterval = ""
+
+			c, _, err := configSchema.ValidateSchema()
+			Expect(err).To(MatchError(ContainSubstring("no registration_interval")))
+			Expect(c.Routes).To(HaveLen(len(configSchema.Routes) - 1))
+			Expect(c.DynamicConfigGlobs).To(Equal(configSchema.DynamicConfigGlobs))
+		})
+	})
+
+	Describe("Options", func() {
+		Context("when decoding JSON", func() {
+			It("type-checks known options", func() {
+				var options config.Options
+				err := json.Unmarshal([]byte(`{"loadbalancing": 5}`), &options)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("keeps unknown scalar options verbatim", func() {
+				var options config.Options
+				err := json.Unmarshal([]byte(`{"loadbalancing": "round-robin", "some_string": "value", "some_number": 1.50, "some_bool": true}`), &options)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(options.LoadBalancingAlgorithm).To(Equal(config.RoundRobin))
+				Expect(options.Unknown).To(Equal(map[string]string{
+					"some_string": "value",
+					"some_number": "1.50",
+					"some_bool":   "true",
+				}))
+			})
+
+			It("rejects unknown options that are not scalars", func() {
+				var options config.Options
+				err := json.Unmarshal([]byte(`{"some_object": {"a": "b"}}`), &options)
+				Expect(err).To(MatchError("option some_object must be a string, number or boolean"))
+			})
+
+			It("round-trips unknown options", func() {
+				options := config.Options{LoadBalancingAlgorithm: config.LeastConns, Unknown: map[string]string{"some_option": "value"}}
+				b, err := json.Marshal(options)
+				Expect(err).NotTo(HaveOccurred())
+
+				var decoded config.Options
+				Expect(json.Unmarshal(b, &decoded)).To(Succeed())
+				Expect(decoded).To(Equal(options))
+			})
+		})
+
+		Context("when decoding YAML", func() {
+			It("type-checks known options", func() {
+				var options config.Options
+				err := yaml.Unmarshal([]byte("loadbalancing: [a, b]"), &options)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("keeps unknown scalar options verbatim", func() {
+				var options config.Options
+				err := yaml.Unmarshal([]byte("loadbalancing: round-robin\nsome_string: value\nsome_number: 1.50\n"), &options)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(options.LoadBalancingAlgorithm).To(Equal(config.RoundRobin))
+				Expect(options.Unknown).To(Equal(map[string]string{
+					"some_string": "value",
+					"some_number": "1.50",
+				}))
+			})
+
+			It("rejects unknown options that are not scalars", func() {
+				var options config.Options
+				err := yaml.Unmarshal([]byte("some_list: [a, b]"), &options)
+				Expect(err).To(MatchError("option some_list must be a string, number or boolean"))
+			})
+
+			It("round-trips unknown options", func() {
+				options := config.Options{LoadBalancingAlgorithm: config.LeastConns, Unknown: map[string]string{"some_option": "value"}}
+				b, err := yaml.Marshal(options)
+				Expect(err).NotTo(HaveOccurred())
+
+				var decoded config.Options
+				Expect(yaml.Unmarshal(b, &decoded)).To(Succeed())
+				Expect(decoded).To(Equal(options))
+			})
+		})
+	})
+
 	Describe("RouteFromSchema", func() {
 		It("loads route from YAML config file", func() {
 			configFile := "../example_config/route.yml"
@@ -1303,7 +2539,7 @@ var _ = Describe("Config", func() {
 			var routeConfig config.RouteSchema
 			err = yaml.Unmarshal(b, &routeConfig)
 			Expect(err).NotTo(HaveOccurred())
-			route, err := config.RouteFromSchema(routeConfig, 0, "")
+			route, err := config.RouteFromSchema(routeConfig, 0, "", config.RouteParseOptions{})
 			Expect(err).NotTo(HaveOccurred())
 			port := uint16(8080)
 			tlsPort := uint16(8443)
@@ -1353,5 +2589,465 @@ var _ = Describe("Config", func() {
 
 			})
 		})
+		Context("when a tcp route has a tls_port and instance_id", func() {
+			var (
+				port         uint16
+				tlsPort      uint16
+				externalPort uint16
+				routeSchema  config.RouteSchema
+			)
+
+			BeforeEach(func() {
+				port = 8080
+				tlsPort = 8443
+				externalPort = 61445
+				routeSchema = config.RouteSchema{
+					Type:                 "tcp",
+					Port:                 &port,
+					TLSPort:              &tlsPort,
+					InstanceID:           "some-instance-id",
+					ExternalPort:         &externalPort,
+					RouterGroup:          "some-router-group",
+					RegistrationInterval: "10s",
+				}
+			})
+
+			It("sets them on the route", func() {
+				route, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(route.TLSPort).To(Equal(&tlsPort))
+				Expect(route.InstanceID).To(Equal("some-instance-id"))
+			})
+
+			It("keeps them on sni routes", func() {
+				routeSchema.Type = "sni"
+				routeSchema.Port = nil
+				routeSchema.SniPort = &port
+				routeSchema.SniRoutableSan = "sni.internal"
+				route, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(route.Port).To(Equal(&port))
+				Expect(route.TLSPort).To(Equal(&tlsPort))
+				Expect(route.InstanceID).To(Equal("some-instance-id"))
+			})
+
+			It("errors when the port is missing", func() {
+				routeSchema.Port = nil
+				_, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).To(MatchError(ContainSubstring("tcp routes require port")))
+			})
+
+			It("errors when the sni_port of an sni route is missing", func() {
+				routeSchema.Type = "sni"
+				_, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).To(MatchError(ContainSubstring("sni routes require sni_port")))
+			})
+
+			It("errors when instance_id is given without tls_port", func() {
+				routeSchema.TLSPort = nil
+				_, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).To(MatchError(ContainSubstring("instance_id requires tls_port")))
+			})
+
+			It("errors when instance_id is given for an http route", func() {
+				routeSchema.Type = ""
+				routeSchema.Name = "some-route"
+				routeSchema.URIs = []string{"some-app.my-domain.com"}
+				routeSchema.ServerCertDomainSAN = "some.service.internal"
+				_, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).To(MatchError(ContainSubstring("instance_id is only supported for tcp and sni routes")))
+			})
+		})
+		Context("when a route has an availability_zone", func() {
+			var (
+				port        uint16
+				routeSchema config.RouteSchema
+			)
+
+			BeforeEach(func() {
+				port = 8080
+				routeSchema = config.RouteSchema{
+					Name:                 "some-route",
+					Port:                 &port,
+					URIs:                 []string{"some-app.my-domain.com"},
+					AvailabilityZone:     "some-route-az",
+					RegistrationInterval: "10s",
+				}
+			})
+
+			It("sets it on the route", func() {
+				route, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(route.AvailabilityZone).To(Equal("some-route-az"))
+			})
+
+			It("errors for tcp routes", func() {
+				externalPort := uint16(61445)
+				routeSchema.Type = "tcp"
+				routeSchema.URIs = nil
+				routeSchema.ExternalPort = &externalPort
+				routeSchema.RouterGroup = "some-router-group"
+				_, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).To(MatchError(ContainSubstring("availability_zone is not supported for tcp and sni routes")))
+			})
+		})
+		Context("when a transport is given", func() {
+			var (
+				port        uint16
+				routeSchema config.RouteSchema
+			)
+
+			BeforeEach(func() {
+				port = 8080
+				routeSchema = config.RouteSchema{
+					Name:                 "some-route",
+					Port:                 &port,
+					RegistrationInterval: "10s",
+					URIs:                 []string{"some-app.my-domain.com"},
+					Transport:            "routing_api",
+				}
+			})
+
+			It("sets the transport of the route", func() {
+				route, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(route.Transport).To(Equal("routing_api"))
+				Expect(route.EffectiveTransport("nats")).To(Equal("routing_api"))
+			})
+
+			It("errors when the transport is unknown", func() {
+				routeSchema.Transport = "carrier-pigeon"
+				_, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).To(MatchError(ContainSubstring("unknown transport: carrier-pigeon")))
+			})
+
+			It("errors when routing_api is used without port", func() {
+				tlsPort := uint16(8443)
+				routeSchema.Port = nil
+				routeSchema.TLSPort = &tlsPort
+				routeSchema.ServerCertDomainSAN = "some.service.internal"
+				_, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).To(MatchError(ContainSubstring("transport routing_api requires port")))
+			})
+
+			It("errors when nats is used for a tcp route", func() {
+				externalPort := uint16(61445)
+				routeSchema.Type = "tcp"
+				routeSchema.ExternalPort = &externalPort
+				routeSchema.RouterGroup = "some-router-group"
+				routeSchema.Transport = "nats"
+				_, err := config.RouteFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+				Expect(err).To(MatchError(ContainSubstring("transport nats is not supported for tcp routes")))
+			})
+		})
+	})
+
+	Describe("RoutesFromSchema", func() {
+		var routeSchema config.RouteSchema
+
+		BeforeEach(func() {
+			routeSchema = config.RouteSchema{
+				Type:                 "tcp",
+				PortRange:            "5000-5199",
+				ExternalPortRange:    "61000-61199",
+				RouterGroup:          "some-router-group",
+				RegistrationInterval: "10s",
+			}
+		})
+
+		It("expands the port ranges into one route per port", func() {
+			routes, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(200))
+
+			for i, route := range routes {
+				Expect(*route.Port).To(Equal(uint16(5000 + i)))
+				Expect(*route.ExternalPort).To(Equal(uint16(61000 + i)))
+				Expect(route.Host).To(Equal("some-host"))
+				Expect(route.RouterGroup).To(Equal("some-router-group"))
+			}
+		})
+
+		It("expands the sni_port of sni routes", func() {
+			routeSchema.Type = "sni"
+			routeSchema.SniRoutableSan = "sni.internal"
+			routes, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(200))
+			Expect(routes[199].Type).To(Equal("tcp"))
+			Expect(*routes[199].Port).To(Equal(uint16(5199)))
+			Expect(*routes[199].ExternalPort).To(Equal(uint16(61199)))
+		})
+
+		It("maps a range of external ports to a single backend port", func() {
+			port := uint16(8080)
+			routeSchema.PortRange = ""
+			routeSchema.Port = &port
+			routeSchema.ExternalPortRange = "61000-61002"
+			routes, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(3))
+			for i, route := range routes {
+				Expect(*route.Port).To(Equal(uint16(8080)))
+				Expect(*route.ExternalPort).To(Equal(uint16(61000 + i)))
+			}
+		})
+
+		It("returns routes without ranges as they are", func() {
+			port := uint16(8080)
+			externalPort := uint16(61000)
+			routeSchema.PortRange = ""
+			routeSchema.ExternalPortRange = ""
+			routeSchema.Port = &port
+			routeSchema.ExternalPort = &externalPort
+			routes, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Port).To(Equal(&port))
+		})
+
+		It("errors when the ranges have different lengths", func() {
+			routeSchema.ExternalPortRange = "61000-61009"
+			_, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).To(MatchError(ContainSubstring("port_range 5000-5199 has 200 ports but external_port_range 61000-61009 has 10 ports")))
+		})
+
+		It("errors when a range leaves the port range", func() {
+			routeSchema.PortRange = "65500-65700"
+			routeSchema.ExternalPortRange = "0-200"
+			_, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).To(MatchError(ContainSubstring(`invalid port_range "65500-65700": last port must be between 1 and 65535`)))
+			Expect(err).To(MatchError(ContainSubstring(`invalid external_port_range "0-200": first port must be between 1 and 65535`)))
+		})
+
+		It("errors when a range is malformed or reversed", func() {
+			routeSchema.PortRange = "5000"
+			routeSchema.ExternalPortRange = "61199-61000"
+			_, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).To(MatchError(ContainSubstring(`invalid port_range "5000": must be of the form FIRST-LAST`)))
+			Expect(err).To(MatchError(ContainSubstring(`invalid external_port_range "61199-61000": first port must not be greater than last port`)))
+		})
+
+		It("errors when a range is combined with a single port", func() {
+			port := uint16(8080)
+			routeSchema.Port = &port
+			routeSchema.ExternalPort = &port
+			_, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).To(MatchError(ContainSubstring("port and port_range are mutually exclusive")))
+			Expect(err).To(MatchError(ContainSubstring("external_port and external_port_range are mutually exclusive")))
+		})
+
+		It("errors for http routes", func() {
+			routeSchema.Type = ""
+			_, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).To(MatchError(ContainSubstring("port_range and external_port_range are only supported for tcp and sni routes")))
+		})
+
+		It("errors when an expanded route is invalid", func() {
+			routeSchema.RouterGroup = ""
+			_, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).To(MatchError(ContainSubstring("route expanded for port 5000, external_port 61000:")))
+			Expect(err).To(MatchError(ContainSubstring("missing router_group")))
+		})
+
+		It("names the sni_port of an invalid expanded sni route", func() {
+			routeSchema.Type = "sni"
+			routeSchema.SniRoutableSan = "sni.internal"
+			routeSchema.RouterGroup = ""
+			_, err := config.RoutesFromSchema(routeSchema, 0, "some-host", config.RouteParseOptions{})
+			Expect(err).To(MatchError(ContainSubstring("route expanded for sni_port 5000, external_port 61000:")))
+		})
+	})
+
+	Describe("RouteClaims", func() {
+		var (
+			claims       *config.RouteClaims
+			port         uint16
+			otherPort    uint16
+			externalPort uint16
+			httpRoute    config.Route
+			tcpRoute     config.Route
+		)
+
+		BeforeEach(func() {
+			claims = config.NewRouteClaims()
+			port = 8080
+			otherPort = 9090
+			externalPort = 61000
+			httpRoute = config.Route{
+				Name: "http-route",
+				Host: "10.0.0.1",
+				Port: &port,
+				URIs: []string{"my-app.example.com", "other-app.example.com"},
+			}
+			tcpRoute = config.Route{
+				Type:         "tcp",
+				Host:         "10.0.0.1",
+				Port:         &port,
+				ExternalPort: &externalPort,
+				RouterGroup:  "default-tcp",
+			}
+			Expect(claims.Claim(httpRoute, "file-a")).To(Succeed())
+			Expect(claims.Claim(tcpRoute, "file-a")).To(Succeed())
+		})
+
+		It("rejects a URI claimed by another source for another backend", func() {
+			conflicting := httpRoute
+			conflicting.Name = "other-route"
+			conflicting.Port = &otherPort
+			conflicting.URIs = []string{"other-app.example.com"}
+
+			err := claims.Claim(conflicting, "file-b")
+			Expect(err).To(MatchError(`route "other-route" in file-b conflicts with route "http-route" in file-a: both claim URI "other-app.example.com"`))
+			Expect(err.(config.RouteConflict).Duplicate).To(BeFalse())
+		})
+
+		It("reports a route for the same backend as duplicate", func() {
+			err := claims.Claim(httpRoute, "file-b")
+			Expect(err).To(MatchError(ContainSubstring(`duplicates route "http-route" in file-a`)))
+			Expect(err.(config.RouteConflict).Duplicate).To(BeTrue())
+		})
+
+		It("rejects an external port claimed by another source in the same router group", func() {
+			conflicting := tcpRoute
+			conflicting.Port = &otherPort
+
+			err := claims.Claim(conflicting, "file-b")
+			Expect(err).To(MatchError(`route for external_port 61000 in file-b conflicts with route for external_port 61000 in file-a: both claim external_port 61000 of router group "default-tcp"`))
+		})
+
+		It("allows the same external port in another router group", func() {
+			other := tcpRoute
+			other.RouterGroup = "other-tcp"
+			Expect(claims.Claim(other, "file-b")).To(Succeed())
+		})
+
+		It("allows routes of the same source to share URIs", func() {
+			other := httpRoute
+			other.Port = &otherPort
+			Expect(claims.Claim(other, "file-a")).To(Succeed())
+		})
+
+		It("rejects an external port claimed by another route of the same source", func() {
+			conflicting := tcpRoute
+			conflicting.Port = &otherPort
+
+			err := claims.Claim(conflicting, "file-a")
+			Expect(err).To(MatchError(ContainSubstring(`both claim external_port 61000 of router group "default-tcp"`)))
+		})
+
+		It("allows claiming a route again", func() {
+			Expect(claims.Claim(tcpRoute, "file-a")).To(Succeed())
+		})
+
+		Context("for sni routes", func() {
+			var sniRoute config.Route
+
+			BeforeEach(func() {
+				sniPort := uint16(62000)
+				sniRoute = tcpRoute
+				sniRoute.Name = "sni-route"
+				sniRoute.ExternalPort = &sniPort
+				sniRoute.ServerCertDomainSAN = "a.internal"
+				Expect(claims.Claim(sniRoute, "file-a")).To(Succeed())
+			})
+
+			It("allows the same external port for another SAN", func() {
+				other := sniRoute
+				other.Name = "other-sni-route"
+				other.ServerCertDomainSAN = "b.internal"
+				Expect(claims.Claim(other, "file-b")).To(Succeed())
+			})
+
+			It("rejects the same external port for the same SAN", func() {
+				conflicting := sniRoute
+				conflicting.Name = "other-sni-route"
+				conflicting.Port = &otherPort
+
+				err := claims.Claim(conflicting, "file-b")
+				Expect(err).To(MatchError(ContainSubstring(`both claim external_port 62000 of router group "default-tcp" for SNI "a.internal"`)))
+			})
+		})
+
+		It("does not record anything for a rejected route", func() {
+			conflicting := httpRoute
+			conflicting.URIs = []string{"new-app.example.com", "my-app.example.com"}
+			Expect(claims.Claim(conflicting, "file-b")).NotTo(Succeed())
+
+			newRoute := httpRoute
+			newRoute.URIs = []string{"new-app.example.com"}
+			Expect(claims.Claim(newRoute, "file-c")).To(Succeed())
+		})
+
+		It("allows claims once the route holding them is released", func() {
+			claims.Release(httpRoute, "file-a")
+			Expect(claims.Claim(httpRoute, "file-b")).To(Succeed())
+		})
+	})
+
+	Describe("DynamicConfigPolicy", func() {
+		var (
+			policy config.DynamicConfigPolicy
+			port   uint16
+		)
+
+		BeforeEach(func() {
+			port = 61005
+			policy = config.DynamicConfigPolicy{
+				Glob:             "/var/vcap/jobs/team-a/*.yml",
+				Domains:          []string{"team-a.example.com"},
+				RouterGroups:     []string{"default-tcp"},
+				ExternalPorts:    []config.PortRange{{First: 61000, Last: 61009}, {First: 62000, Last: 62000}},
+				RouteServiceURLs: []string{"https://route-service.example.com"},
+			}
+		})
+
+		It("allows URIs in the domains and their subdomains", func() {
+			route := config.Route{URIs: []string{"team-a.example.com", "app.team-a.example.com/path", "*.team-a.example.com"}}
+			Expect(policy.Allows(route)).To(Succeed())
+		})
+
+		It("rejects URIs outside the domains", func() {
+			route := config.Route{URIs: []string{"app.team-b.example.com", "evilteam-a.example.com"}}
+			err := policy.Allows(route)
+			Expect(err).To(MatchError(ContainSubstring(`errors with 'policy for glob "/var/vcap/jobs/team-a/*.yml"'`)))
+			Expect(err).To(MatchError(ContainSubstring(`URI "app.team-b.example.com" is not in an allowed domain`)))
+			Expect(err).To(MatchError(ContainSubstring(`URI "evilteam-a.example.com" is not in an allowed domain`)))
+		})
+
+		It("allows tcp routes in the router groups and external ports", func() {
+			route := config.Route{Type: "tcp", RouterGroup: "default-tcp", ExternalPort: &port}
+			Expect(policy.Allows(route)).To(Succeed())
+		})
+
+		It("rejects tcp routes outside the router groups and external ports", func() {
+			port = 61010
+			route := config.Route{Type: "tcp", RouterGroup: "other-tcp", ExternalPort: &port}
+			err := policy.Allows(route)
+			Expect(err).To(MatchError(ContainSubstring(`router group "other-tcp" is not allowed`)))
+			Expect(err).To(MatchError(ContainSubstring("external port 61010 is not allowed")))
+		})
+
+		It("rejects tcp routes without an external port when the external ports are restricted", func() {
+			route := config.Route{Type: "tcp", RouterGroup: "default-tcp"}
+			Expect(policy.Allows(route)).To(MatchError(ContainSubstring("external port must be set, as the allowed external ports are restricted")))
+		})
+
+		It("allows tcp routes without an external port when the external ports are not restricted", func() {
+			policy.ExternalPorts = nil
+			route := config.Route{Type: "tcp", RouterGroup: "default-tcp"}
+			Expect(policy.Allows(route)).To(Succeed())
+		})
+
+		It("rejects route service URLs that are not listed", func() {
+			route := config.Route{URIs: []string{"team-a.example.com"}, RouteServiceUrl: "https://other.example.com"}
+			Expect(policy.Allows(route)).To(MatchError(ContainSubstring(`route service URL "https://other.example.com" is not allowed`)))
+		})
+
+		It("does not restrict what it does not list", func() {
+			policy = config.DynamicConfigPolicy{Glob: "*"}
+			route := config.Route{URIs: []string{"anything.example.org"}, RouteServiceUrl: "https://other.example.com"}
+			Expect(policy.Allows(route)).To(Succeed())
+		})
 	})
 })
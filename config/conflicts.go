@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// RouteConflict is returned when a route claims a URI, or an external port of
+// a router group, that another route has already claimed.
+type RouteConflict struct {
+	Claim          string
+	Source         string
+	Route          string
+	ExistingSource string
+	ExistingRoute  string
+
+	// Duplicate is true when both routes point to the same backend.
+	Duplicate bool
+}
+
+func (c RouteConflict) Error() string {
+	kind := "conflicts with"
+	if c.Duplicate {
+		kind = "duplicates"
+	}
+	return fmt.Sprintf(
+		"route %s in %s %s route %s in %s: both claim %s",
+		c.Route, c.Source, kind, c.ExistingRoute, c.ExistingSource, c.Claim,
+	)
+}
+
+type routeClaim struct {
+	route  Route
+	source string
+}
+
+// MainConfigSource is the source routes of the main config claim with, which
+// conflicts with them are reported against.
+const MainConfigSource = "the main config"
+
+// RouteClaims keeps track of the URIs and TCP external ports claimed by
+// routes. SNI routes only claim an external port for their SAN. Routes from
+// the same source, e.g. the same config file, may share URIs to pool their
+// backends, but not external ports.
+type RouteClaims struct {
+	lock   sync.Mutex
+	claims map[string][]routeClaim
+}
+
+func NewRouteClaims() *RouteClaims {
+	return &RouteClaims{claims: map[string][]routeClaim{}}
+}
+
+// Claim records the claims of the route, unless one of them is already held
+// by a route from another source, or an external port by another route from
+// the same source, in which case a RouteConflict is returned and nothing is
+// recorded. Claiming a route again is a no-op.
+func (c *RouteClaims) Claim(route Route, source string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	keys := claimKeys(route)
+	for _, key := range keys {
+		for _, existing := range c.claims[key] {
+			if existing.source == source && (route.Type != "tcp" || reflect.DeepEqual(existing.route, route)) {
+				continue
+			}
+			return RouteConflict{
+				Claim:          key,
+				Source:         source,
+				Route:          routeName(route),
+				ExistingSource: existing.source,
+				ExistingRoute:  routeName(existing.route),
+				Duplicate:      sameBackend(route, existing.route),
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if !containsClaim(c.claims[key], route, source) {
+			c.claims[key] = append(c.claims[key], routeClaim{route: route, source: source})
+		}
+	}
+	return nil
+}
+
+// Release removes the claims of the route.
+func (c *RouteClaims) Release(route Route, source string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, key := range claimKeys(route) {
+		remaining := []routeClaim{}
+		for _, existing := range c.claims[key] {
+			if existing.source != source || !reflect.DeepEqual(existing.route, route) {
+				remaining = append(remaining, existing)
+			}
+		}
+
+		if len(remaining) == 0 {
+			delete(c.claims, key)
+		} else {
+			c.claims[key] = remaining
+		}
+	}
+}
+
+func claimKeys(route Route) []string {
+	if route.Type == "tcp" {
+		if route.ExternalPort == nil {
+			return nil
+		}
+		if route.ServerCertDomainSAN != "" {
+			return []string{fmt.Sprintf("external_port %d of router group %q for SNI %q", *route.ExternalPort, route.RouterGroup, route.ServerCertDomainSAN)}
+		}
+		return []string{fmt.Sprintf("external_port %d of router group %q", *route.ExternalPort, route.RouterGroup)}
+	}
+
+	keys := make([]string, 0, len(route.URIs))
+	for _, uri := range route.URIs {
+		keys = append(keys, fmt.Sprintf("URI %q", uri))
+	}
+	return keys
+}
+
+func containsClaim(claims []routeClaim, route Route, source string) bool {
+	for _, claim := range claims {
+		if claim.source == source && reflect.DeepEqual(claim.route, route) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameBackend(a, b Route) bool {
+	return a.Host == b.Host &&
+		reflect.DeepEqual(a.Port, b.Port) &&
+		reflect.DeepEqual(a.TLSPort, b.TLSPort)
+}
+
+func routeName(route Route) string {
+	if route.Name != "" {
+		return fmt.Sprintf("%q", route.Name)
+	}
+	if route.ExternalPort != nil {
+		return fmt.Sprintf("for external_port %d", *route.ExternalPort)
+	}
+	return "without name"
+}
@@ -0,0 +1,61 @@
+package config
+
+// RouteDefaultsSchema holds the values routes inherit when they do not set
+// them themselves.
+type RouteDefaultsSchema struct {
+	RegistrationInterval string             `json:"registration_interval,omitempty" yaml:"registration_interval,omitempty"`
+	Tags                 map[string]string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	HealthCheck          *HealthCheckSchema `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+	RouterGroup          string             `json:"router_group,omitempty" yaml:"router_group,omitempty"`
+	Options              *Options           `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// WithDefaults returns the route with the defaults merged under it. Earlier
+// defaults take precedence over later ones. Tags are merged key by key,
+// options of a route replace the default options; router_group only applies
+// to tcp and sni routes.
+func (r RouteSchema) WithDefaults(defaults ...RouteDefaultsSchema) RouteSchema {
+	for _, d := range defaults {
+		if r.RegistrationInterval == "" {
+			r.RegistrationInterval = d.RegistrationInterval
+		}
+		if r.HealthCheck == nil {
+			r.HealthCheck = d.HealthCheck
+		}
+		if r.RouterGroup == "" && (r.Type == "tcp" || r.Type == "sni") {
+			r.RouterGroup = d.RouterGroup
+		}
+		r.Tags = mergeTags(r.Tags, d.Tags)
+		r.Options = defaultOptions(r.Options, d.Options)
+	}
+	return r
+}
+
+func mergeTags(tags, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return tags
+	}
+
+	merged := make(map[string]string, len(tags)+len(defaults))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// defaultOptions returns the options of a route, or a copy of the default
+// options when the route has none. Options are not merged key by key, as
+// they depend on each other: hash_header, for example, is only valid with
+// the hash load balancing algorithm.
+func defaultOptions(options, defaults *Options) *Options {
+	if options != nil || defaults == nil {
+		return options
+	}
+
+	copied := *defaults
+	copied.Unknown = mergeTags(nil, defaults.Unknown)
+	return &copied
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyIPv6 = "ipv6"
+)
+
+// placeholderHost is used instead of the detected host when validating a
+// config for another machine.
+const placeholderHost = "192.0.2.1"
+
+// resolveHost sets Host to the local address selected by host_interface
+// and/or host_cidr, when they are configured. When skip is true, only the
+// settings are checked and Host is set to a placeholder; the returned
+// description says what was skipped.
+func (c *ConfigSchema) resolveHost(skip bool) (string, error) {
+	if c.HostInterface == "" && c.HostCIDR == "" {
+		if c.HostIPPreference != "" {
+			return "", fmt.Errorf("host_ip_preference requires host_interface or host_cidr")
+		}
+		return "", nil
+	}
+
+	if c.Host != "" {
+		return "", fmt.Errorf("host is mutually exclusive with host_interface and host_cidr")
+	}
+
+	if skip {
+		_, err := parseHostSelection(c.HostCIDR, c.HostIPPreference)
+		if err != nil {
+			return "", err
+		}
+		c.Host = placeholderHost
+		return fmt.Sprintf("host: not detected from %s", hostSelector(c.HostInterface, c.HostCIDR)), nil
+	}
+
+	host, err := detectHost(c.HostInterface, c.HostCIDR, c.HostIPPreference)
+	if err != nil {
+		return "", err
+	}
+	c.Host = host
+	return "", nil
+}
+
+// parseHostSelection checks the preference and returns the network of the
+// cidr, or nil when cidr is empty.
+func parseHostSelection(cidr string, preference string) (*net.IPNet, error) {
+	switch preference {
+	case "", IPFamilyIPv4, IPFamilyIPv6:
+	default:
+		return nil, fmt.Errorf("unknown host_ip_preference: %s. Supported preferences: %s, %s", preference, IPFamilyIPv4, IPFamilyIPv6)
+	}
+
+	if cidr == "" {
+		return nil, nil
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host_cidr: %s", err)
+	}
+	return network, nil
+}
+
+// detectHost returns the only address of the interface, or of any interface
+// when iface is empty, that is in cidr. Link-local addresses are ignored.
+// When preference is set and addresses of that family match, addresses of
+// the other family are ignored.
+func detectHost(iface string, cidr string, preference string) (string, error) {
+	network, err := parseHostSelection(cidr, preference)
+	if err != nil {
+		return "", err
+	}
+
+	var addrs []net.Addr
+	if iface != "" {
+		i, err := net.InterfaceByName(iface)
+		if err != nil {
+			return "", fmt.Errorf("invalid host_interface %q: %s", iface, err)
+		}
+		addrs, err = i.Addrs()
+		if err != nil {
+			return "", fmt.Errorf("failed to list addresses of host_interface %q: %s", iface, err)
+		}
+	} else {
+		addrs, err = net.InterfaceAddrs()
+		if err != nil {
+			return "", fmt.Errorf("failed to list interface addresses: %s", err)
+		}
+	}
+
+	ipv4, ipv6 := []string{}, []string{}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if network != nil && !network.Contains(ipNet.IP) {
+			continue
+		}
+
+		if ipNet.IP.To4() != nil {
+			ipv4 = append(ipv4, ipNet.IP.String())
+		} else {
+			ipv6 = append(ipv6, ipNet.IP.String())
+		}
+	}
+
+	matches := append(append([]string{}, ipv4...), ipv6...)
+	if preference == IPFamilyIPv4 && len(ipv4) > 0 {
+		matches = ipv4
+	}
+	if preference == IPFamilyIPv6 && len(ipv6) > 0 {
+		matches = ipv6
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no address matches %s", hostSelector(iface, cidr))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple addresses match %s: %s", hostSelector(iface, cidr), strings.Join(matches, ", "))
+	}
+}
+
+func hostSelector(iface string, cidr string) string {
+	selectors := []string{}
+	if iface != "" {
+		selectors = append(selectors, fmt.Sprintf("host_interface %q", iface))
+	}
+	if cidr != "" {
+		selectors = append(selectors, fmt.Sprintf("host_cidr %q", cidr))
+	}
+	return strings.Join(selectors, " and ")
+}
+
+// normalizeHost validates a backend host that looks like an IPv6 address.
+// IPv6 addresses may be given with or without brackets and are returned in
+// their canonical form without brackets, as gorouter and the Routing API
+// expect them. Other hosts are returned as they are.
+func normalizeHost(host string) (string, error) {
+	if !strings.HasPrefix(host, "[") && !strings.Contains(host, ":") {
+		return host, nil
+	}
+
+	address := host
+	if strings.HasPrefix(address, "[") && strings.HasSuffix(address, "]") {
+		address = address[1 : len(address)-1]
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid host %q: must be an IP address or hostname without port", host)
+	}
+	return ip.String(), nil
+}
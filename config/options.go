@@ -0,0 +1,135 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// knownOptions has the same fields as Options but none of its methods, so it
+// can be used to (un)marshal the typed options without recursing.
+type knownOptions Options
+
+func (o *Options) UnmarshalJSON(data []byte) error {
+	var known knownOptions
+	err := json.Unmarshal(data, &known)
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range raw {
+		if isKnownRouteOption(key) {
+			continue
+		}
+
+		var s string
+		switch {
+		case bytes.HasPrefix(value, []byte(`"`)):
+			err = json.Unmarshal(value, &s)
+			if err != nil {
+				return err
+			}
+		case bytes.HasPrefix(value, []byte(`{`)), bytes.HasPrefix(value, []byte(`[`)), bytes.Equal(value, []byte(`null`)):
+			return fmt.Errorf("option %s must be a string, number or boolean", key)
+		default:
+			s = string(value)
+		}
+
+		if known.Unknown == nil {
+			known.Unknown = map[string]string{}
+		}
+		known.Unknown[key] = s
+	}
+
+	*o = Options(known)
+	return nil
+}
+
+func (o Options) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(knownOptions(o))
+	if err != nil || len(o.Unknown) == 0 {
+		return data, err
+	}
+
+	var merged map[string]interface{}
+	err = json.Unmarshal(data, &merged)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range o.Unknown {
+		merged[key] = value
+	}
+
+	return json.Marshal(merged)
+}
+
+func (o *Options) UnmarshalYAML(value *yaml.Node) error {
+	var known knownOptions
+	err := value.Decode(&known)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, v := value.Content[i].Value, value.Content[i+1]
+		if isKnownRouteOption(key) {
+			continue
+		}
+
+		if v.Kind != yaml.ScalarNode || v.Tag == "!!null" {
+			return fmt.Errorf("option %s must be a string, number or boolean", key)
+		}
+
+		if known.Unknown == nil {
+			known.Unknown = map[string]string{}
+		}
+		known.Unknown[key] = v.Value
+	}
+
+	*o = Options(known)
+	return nil
+}
+
+func (o Options) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{}
+	err := node.Encode(knownOptions(o))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range sortedKeys(o.Unknown) {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: o.Unknown[key]},
+		)
+	}
+
+	return node, nil
+}
+
+func isKnownRouteOption(key string) bool {
+	for _, k := range knownRouteOptions {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/multierror"
+)
+
+// DynamicConfigPolicySchema restricts what the routes of the dynamic config
+// files matching Glob, or owned by OwnerUID, may claim. Empty lists do not
+// restrict anything.
+type DynamicConfigPolicySchema struct {
+	Glob             string   `json:"glob,omitempty" yaml:"glob,omitempty"`
+	OwnerUID         *uint32  `json:"owner_uid,omitempty" yaml:"owner_uid,omitempty"`
+	Domains          []string `json:"domains,omitempty" yaml:"domains,omitempty"`
+	RouterGroups     []string `json:"router_groups,omitempty" yaml:"router_groups,omitempty"`
+	ExternalPorts    []string `json:"external_ports,omitempty" yaml:"external_ports,omitempty"`
+	RouteServiceURLs []string `json:"route_service_urls,omitempty" yaml:"route_service_urls,omitempty"`
+}
+
+type DynamicConfigPolicy struct {
+	Glob             string
+	OwnerUID         *uint32
+	Domains          []string
+	RouterGroups     []string
+	ExternalPorts    []PortRange
+	RouteServiceURLs []string
+}
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	First uint16
+	Last  uint16
+}
+
+func (p PortRange) contains(port uint16) bool {
+	return port >= p.First && port <= p.Last
+}
+
+func dynamicConfigPoliciesFromSchema(schemas []DynamicConfigPolicySchema) ([]DynamicConfigPolicy, error) {
+	errors := multierror.NewMultiError("dynamic_config_policies")
+
+	var policies []DynamicConfigPolicy
+	for i, p := range schemas {
+		policy := DynamicConfigPolicy{
+			Glob:             p.Glob,
+			OwnerUID:         p.OwnerUID,
+			RouterGroups:     p.RouterGroups,
+			RouteServiceURLs: p.RouteServiceURLs,
+		}
+
+		if p.Glob == "" && p.OwnerUID == nil {
+			errors.Add(fmt.Errorf("policy %d: glob or owner_uid must be provided", i))
+		}
+		if p.Glob != "" {
+			if _, err := filepath.Match(p.Glob, ""); err != nil {
+				errors.Add(fmt.Errorf("policy %d: invalid glob %q: %s", i, p.Glob, err))
+			}
+		}
+
+		for _, domain := range p.Domains {
+			domain = strings.ToLower(domain)
+			if err := validateHostname(domain); err != nil || strings.HasPrefix(domain, "*.") {
+				errors.Add(fmt.Errorf("policy %d: invalid domain %q", i, domain))
+				continue
+			}
+			policy.Domains = append(policy.Domains, domain)
+		}
+
+		for _, ports := range p.ExternalPorts {
+			first, last, err := parsePortBounds("external_ports", ports, true)
+			if err != nil {
+				errors.Add(fmt.Errorf("policy %d: %s", i, err))
+				continue
+			}
+			policy.ExternalPorts = append(policy.ExternalPorts, PortRange{First: first, Last: last})
+		}
+
+		policies = append(policies, policy)
+	}
+
+	if errors.Length() > 0 {
+		return nil, errors
+	}
+	return policies, nil
+}
+
+// Allows returns an error for every claim of the route the policy does not
+// allow.
+func (p DynamicConfigPolicy) Allows(route Route) error {
+	errors := multierror.NewMultiError(p.String())
+
+	if route.Type == "tcp" {
+		if len(p.RouterGroups) > 0 && !contains(p.RouterGroups, route.RouterGroup) {
+			errors.Add(fmt.Errorf("router group %q is not allowed", route.RouterGroup))
+		}
+		if len(p.ExternalPorts) > 0 {
+			if route.ExternalPort == nil {
+				errors.Add(fmt.Errorf("external port must be set, as the allowed external ports are restricted"))
+			} else if !p.allowsExternalPort(*route.ExternalPort) {
+				errors.Add(fmt.Errorf("external port %d is not allowed", *route.ExternalPort))
+			}
+		}
+	} else if len(p.Domains) > 0 {
+		for _, uri := range route.URIs {
+			if !p.allowsURI(uri) {
+				errors.Add(fmt.Errorf("URI %q is not in an allowed domain", uri))
+			}
+		}
+	}
+
+	if route.RouteServiceUrl != "" && len(p.RouteServiceURLs) > 0 && !contains(p.RouteServiceURLs, route.RouteServiceUrl) {
+		errors.Add(fmt.Errorf("route service URL %q is not allowed", route.RouteServiceUrl))
+	}
+
+	if errors.Length() > 0 {
+		return errors
+	}
+	return nil
+}
+
+func (p DynamicConfigPolicy) String() string {
+	switch {
+	case p.Glob != "" && p.OwnerUID != nil:
+		return fmt.Sprintf("policy for glob %q and owner_uid %d", p.Glob, *p.OwnerUID)
+	case p.OwnerUID != nil:
+		return fmt.Sprintf("policy for owner_uid %d", *p.OwnerUID)
+	default:
+		return fmt.Sprintf("policy for glob %q", p.Glob)
+	}
+}
+
+// allowsURI allows URIs in one of the domains or their subdomains.
+func (p DynamicConfigPolicy) allowsURI(uri string) bool {
+	host, _, _ := strings.Cut(uri, "/")
+	host = strings.TrimPrefix(host, "*.")
+	for _, domain := range p.Domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p DynamicConfigPolicy) allowsExternalPort(port uint16) bool {
+	for _, ports := range p.ExternalPorts {
+		if ports.contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/multierror"
+)
+
+// RoutesFromSchema returns the routes described by the route schema. Routes
+// with a port_range or external_port_range are expanded into one route per
+// port; all other routes are returned as a single route.
+func RoutesFromSchema(r RouteSchema, index int, host string, opts RouteParseOptions) ([]Route, error) {
+	if r.PortRange == "" && r.ExternalPortRange == "" {
+		route, err := RouteFromSchema(r, index, host, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []Route{*route}, nil
+	}
+
+	ports, externalPorts, err := portRangesFromSchema(r, index)
+	if err != nil {
+		return nil, err
+	}
+
+	count := len(ports)
+	if count == 0 {
+		count = len(externalPorts)
+	}
+
+	routes := make([]Route, 0, count)
+	for i := 0; i < count; i++ {
+		expanded := r
+		expanded.PortRange = ""
+		expanded.ExternalPortRange = ""
+
+		expandedPorts := []string{}
+		if len(ports) > 0 {
+			port := ports[i]
+			if r.Type == "sni" {
+				expanded.SniPort = &port
+				expandedPorts = append(expandedPorts, fmt.Sprintf("sni_port %d", port))
+			} else {
+				expanded.Port = &port
+				expandedPorts = append(expandedPorts, fmt.Sprintf("port %d", port))
+			}
+		}
+		if len(externalPorts) > 0 {
+			externalPort := externalPorts[i]
+			expanded.ExternalPort = &externalPort
+			expandedPorts = append(expandedPorts, fmt.Sprintf("external_port %d", externalPort))
+		}
+
+		route, err := RouteFromSchema(expanded, index, host, opts)
+		if err != nil {
+			return nil, fmt.Errorf("route expanded for %s: %s", strings.Join(expandedPorts, ", "), err)
+		}
+		routes = append(routes, *route)
+	}
+
+	return routes, nil
+}
+
+func portRangesFromSchema(r RouteSchema, index int) ([]uint16, []uint16, error) {
+	errors := multierror.NewMultiError(fmt.Sprintf("route %s", nameOrIndex(r, index)))
+
+	if r.Type != "tcp" && r.Type != "sni" {
+		errors.Add(fmt.Errorf("port_range and external_port_range are only supported for tcp and sni routes"))
+		return nil, nil, errors
+	}
+
+	var ports, externalPorts []uint16
+	if r.PortRange != "" {
+		if r.Type == "tcp" && r.Port != nil {
+			errors.Add(fmt.Errorf("port and port_range are mutually exclusive"))
+		}
+		if r.Type == "sni" && r.SniPort != nil {
+			errors.Add(fmt.Errorf("sni_port and port_range are mutually exclusive"))
+		}
+
+		var err error
+		ports, err = parsePortRange("port_range", r.PortRange)
+		if err != nil {
+			errors.Add(err)
+		}
+	}
+
+	if r.ExternalPortRange != "" {
+		if r.ExternalPort != nil {
+			errors.Add(fmt.Errorf("external_port and external_port_range are mutually exclusive"))
+		}
+
+		var err error
+		externalPorts, err = parsePortRange("external_port_range", r.ExternalPortRange)
+		if err != nil {
+			errors.Add(err)
+		}
+	}
+
+	if len(ports) > 0 && len(externalPorts) > 0 && len(ports) != len(externalPorts) {
+		errors.Add(fmt.Errorf(
+			"port_range %s has %d ports but external_port_range %s has %d ports",
+			r.PortRange, len(ports), r.ExternalPortRange, len(externalPorts),
+		))
+	}
+
+	if errors.Length() > 0 {
+		return nil, nil, errors
+	}
+	return ports, externalPorts, nil
+}
+
+// parsePortRange parses an inclusive port range such as "5000-5199".
+func parsePortRange(name string, portRange string) ([]uint16, error) {
+	first, last, err := parsePortBounds(name, portRange, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make([]uint16, 0, int(last)-int(first)+1)
+	for port := int(first); port <= int(last); port++ {
+		ports = append(ports, uint16(port))
+	}
+	return ports, nil
+}
+
+// parsePortBounds returns the first and last port of an inclusive port range
+// such as "5000-5199". When allowSinglePort is set, a single port such as
+// "5000" is accepted as well.
+func parsePortBounds(name string, portRange string, allowSinglePort bool) (uint16, uint16, error) {
+	from, to, found := strings.Cut(portRange, "-")
+	if !found {
+		if !allowSinglePort {
+			return 0, 0, fmt.Errorf("invalid %s %q: must be of the form FIRST-LAST", name, portRange)
+		}
+		to = from
+	}
+
+	first, err := strconv.ParseUint(strings.TrimSpace(from), 10, 16)
+	if err != nil || first == 0 {
+		return 0, 0, fmt.Errorf("invalid %s %q: first port must be between 1 and 65535", name, portRange)
+	}
+	last, err := strconv.ParseUint(strings.TrimSpace(to), 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid %s %q: last port must be between 1 and 65535", name, portRange)
+	}
+	if first > last {
+		return 0, 0, fmt.Errorf("invalid %s %q: first port must not be greater than last port", name, portRange)
+	}
+
+	return uint16(first), uint16(last), nil
+}
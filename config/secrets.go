@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var envVarReferenceRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// placeholderSecret replaces ${ENV_VAR} references and the contents of
+// secret files when validating a config for another machine.
+const placeholderSecret = "placeholder"
+
+// resolveSecrets expands ${ENV_VAR} references in the credentials and
+// endpoints of the message bus servers and the routing API, and reads
+// password_file and client_secret_file. The schema is modified in place, so
+// it must not share its message bus servers with the caller. When skip is
+// true, references and secret files are replaced by a placeholder instead and
+// returned as skipped.
+func (c *ConfigSchema) resolveSecrets(skip bool) ([]error, []string) {
+	var errs []error
+	var skipped []string
+	expand := func(field string, value *string) {
+		if skip {
+			references := envVarReferenceRegexp.FindAllString(*value, -1)
+			if len(references) > 0 {
+				skipped = append(skipped, fmt.Sprintf("%s: %s not resolved", field, strings.Join(references, ", ")))
+				*value = envVarReferenceRegexp.ReplaceAllString(*value, placeholderSecret)
+			}
+			return
+		}
+
+		expanded, err := expandEnvVarReferences(field, *value)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		*value = expanded
+	}
+	readFile := func(prefix string, name string, secret *string, path string) {
+		if skip && path != "" && *secret == "" {
+			skipped = append(skipped, fmt.Sprintf("%s.%s_file: not read", prefix, name))
+			*secret = placeholderSecret
+			return
+		}
+
+		err := readSecretFile(prefix, name, secret, path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	expand("host", &c.Host)
+
+	for i := range c.MessageBusServers {
+		server := &c.MessageBusServers[i]
+		prefix := fmt.Sprintf("message_bus_servers[%d]", i)
+
+		expand(prefix+".host", &server.Host)
+		expand(prefix+".user", &server.User)
+		expand(prefix+".password", &server.Password)
+		expand(prefix+".password_file", &server.PasswordFile)
+		readFile(prefix, "password", &server.Password, server.PasswordFile)
+	}
+
+	api := &c.RoutingAPI
+	expand("routing_api.api_url", &api.APIURL)
+	expand("routing_api.oauth_url", &api.OAuthURL)
+	expand("routing_api.client_id", &api.ClientID)
+	expand("routing_api.client_secret", &api.ClientSecret)
+	expand("routing_api.client_secret_file", &api.ClientSecretFile)
+	readFile("routing_api", "client_secret", &api.ClientSecret, api.ClientSecretFile)
+
+	return errs, skipped
+}
+
+// expandEnvVarReferences replaces every ${ENV_VAR} in value with the value
+// of the environment variable. Other uses of $ are left as they are.
+func expandEnvVarReferences(field string, value string) (string, error) {
+	var missing []string
+	expanded := envVarReferenceRegexp.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envVarReferenceRegexp.FindStringSubmatch(reference)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return envValue
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%s references unset environment variable %s", field, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// readSecretFile sets the secret to the contents of path, without trailing
+// newlines, when path is set.
+func readSecretFile(prefix string, name string, secret *string, path string) error {
+	if path == "" {
+		return nil
+	}
+	if *secret != "" {
+		return fmt.Errorf("%s: %s and %s_file are mutually exclusive", prefix, name, name)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: failed to read %s_file: %s", prefix, name, err)
+	}
+
+	*secret = strings.TrimRight(string(contents), "\r\n")
+	return nil
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnknownFieldError reports a key in a config file that does not correspond
+// to any field of the schema.
+type UnknownFieldError struct {
+	// Path is where the key was found, e.g. routes[1].health_check. It is
+	// empty for keys at the top level.
+	Path string
+	// RouteIndex is the index of the route the key belongs to, or -1.
+	RouteIndex int
+	// RouteName is the name of that route, if it has one.
+	RouteName  string
+	Field      string
+	Suggestion string
+}
+
+func (e UnknownFieldError) Error() string {
+	msg := fmt.Sprintf("unknown field %q", e.Field)
+	if e.Path != "" {
+		msg += " in " + e.Path
+	}
+	if e.RouteName != "" {
+		msg += fmt.Sprintf(" (route %q)", e.RouteName)
+	}
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %q?", e.Suggestion)
+	}
+	return msg
+}
+
+var (
+	routeSchemaType = reflect.TypeOf(RouteSchema{})
+	optionsType     = reflect.TypeOf(Options{})
+)
+
+// UnknownFields parses the JSON or YAML document and returns an error for
+// every key that does not correspond to a field of schema, a struct using
+// the same yaml or json tags as the schema types in this package. Route
+// options are not checked, as unknown options are handled by
+// allow_unknown_route_options.
+func UnknownFields(data []byte, schema interface{}) ([]UnknownFieldError, error) {
+	var document interface{}
+	err := errors.New("not JSON")
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, &document)
+	}
+	if err != nil {
+		document = nil
+		err = yaml.Unmarshal(data, &document)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	errs := []UnknownFieldError{}
+	walkUnknownFields(document, reflect.TypeOf(schema), "", -1, "", &errs)
+	return errs, nil
+}
+
+func walkUnknownFields(value interface{}, t reflect.Type, path string, routeIndex int, routeName string, errs *[]UnknownFieldError) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == optionsType {
+			return
+		}
+
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		known := schemaFields(t)
+		names := make([]string, 0, len(known))
+		for name := range known {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field, ok := known[key]
+			if !ok {
+				*errs = append(*errs, UnknownFieldError{
+					Path:       path,
+					RouteIndex: routeIndex,
+					RouteName:  routeName,
+					Field:      key,
+					Suggestion: suggestField(key, names),
+				})
+				continue
+			}
+			walkUnknownFields(fields[key], field.Type, joinPath(path, key), routeIndex, routeName, errs)
+		}
+
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+
+		for i, item := range items {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			if t.Elem() == routeSchemaType {
+				name := ""
+				if fields, ok := item.(map[string]interface{}); ok {
+					name, _ = fields["name"].(string)
+				}
+				walkUnknownFields(item, t.Elem(), itemPath, i, name, errs)
+				continue
+			}
+			walkUnknownFields(item, t.Elem(), itemPath, routeIndex, routeName, errs)
+		}
+	}
+}
+
+// schemaFields returns the fields of the struct type by their config key.
+func schemaFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := tagName(field.Tag.Get("yaml"))
+		if name == "" {
+			name = tagName(field.Tag.Get("json"))
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if name == "-" {
+			continue
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+func tagName(tag string) string {
+	return strings.Split(tag, ",")[0]
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggestField returns the known field closest to the unknown one, if it is
+// close enough to be a typo.
+func suggestField(field string, known []string) string {
+	suggestion := ""
+	maxDistance := len(field) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	best := maxDistance + 1
+
+	for _, name := range known {
+		d := editDistance(strings.ToLower(field), name)
+		if d < best {
+			best = d
+			suggestion = name
+		}
+	}
+	return suggestion
+}
+
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
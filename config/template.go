@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"code.cloudfoundry.org/multierror"
+)
+
+// TemplateData is available to the templates in the name, uris and tags of
+// routes, e.g. {{.AvailabilityZone}}, {{.Deployment}} or {{.Env.FOO}}. Env
+// only holds the environment variables listed in template_env, so that
+// templates cannot leak secrets passed in the environment.
+type TemplateData struct {
+	AvailabilityZone string
+	Deployment       string
+	InstanceID       string
+	Host             string
+	Hostname         string
+	Env              map[string]string
+}
+
+// NewTemplateData returns the template data for the host described by the
+// config.
+func NewTemplateData(c Config) (TemplateData, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return TemplateData{}, fmt.Errorf("failed to determine hostname: %s", err)
+	}
+
+	env := map[string]string{}
+	for _, name := range c.TemplateEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+
+	return TemplateData{
+		AvailabilityZone: c.AvailabilityZone,
+		Deployment:       c.Deployment,
+		InstanceID:       c.InstanceID,
+		Host:             c.Host,
+		Hostname:         hostname,
+		Env:              env,
+	}, nil
+}
+
+// ExpandTemplates returns the route with the templates in its name, uris and
+// tag values expanded. Referencing an environment variable that is unset or
+// not listed in template_env is an error.
+func (r RouteSchema) ExpandTemplates(data TemplateData, index int) (RouteSchema, error) {
+	errors := multierror.NewMultiError(fmt.Sprintf("route %s", nameOrIndex(r, index)))
+
+	expand := func(field string, value string) string {
+		expanded, err := expandTemplate(value, data)
+		if err != nil {
+			errors.Add(fmt.Errorf("invalid template in %s: %s", field, err))
+			return value
+		}
+		return expanded
+	}
+
+	r.Name = expand("name", r.Name)
+
+	if r.URIs != nil {
+		uris := make([]string, len(r.URIs))
+		for i, uri := range r.URIs {
+			uris[i] = expand(fmt.Sprintf("uris[%d]", i), uri)
+		}
+		r.URIs = uris
+	}
+
+	if r.Tags != nil {
+		tags := make(map[string]string, len(r.Tags))
+		for _, k := range sortedKeys(r.Tags) {
+			tags[k] = expand(fmt.Sprintf("tags.%s", k), r.Tags[k])
+		}
+		r.Tags = tags
+	}
+
+	if errors.Length() > 0 {
+		return r, errors
+	}
+	return r, nil
+}
+
+func expandTemplate(value string, data TemplateData) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+
+	t, err := template.New("").Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	var expanded strings.Builder
+	err = t.Execute(&expanded, data)
+	if err != nil {
+		return "", err
+	}
+	return expanded.String(), nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxHostnameLength = 253
+	maxLabelLength    = 63
+)
+
+// normalizeURIs validates the URIs of an http route and returns them with
+// their hostnames in lowercase. A URI is a hostname, optionally starting with
+// a "*." wildcard, followed by an optional path. Empty URIs are skipped, as
+// they are reported separately.
+func normalizeURIs(uris []string) ([]string, []error) {
+	normalized := make([]string, 0, len(uris))
+	errs := []error{}
+
+	for _, u := range uris {
+		if u == "" {
+			continue
+		}
+
+		n, err := normalizeURI(u)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		normalized = append(normalized, n)
+	}
+
+	return normalized, errs
+}
+
+func normalizeURI(uri string) (string, error) {
+	if strings.Contains(uri, "://") {
+		return "", fmt.Errorf("invalid URI %q: must not contain a scheme", uri)
+	}
+
+	host, path, hasPath := strings.Cut(uri, "/")
+	host = strings.ToLower(host)
+
+	err := validateHostname(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid URI %q: %s", uri, err)
+	}
+
+	if !hasPath {
+		return host, nil
+	}
+
+	for _, c := range path {
+		if unicode.IsSpace(c) || unicode.IsControl(c) || c == '?' || c == '#' {
+			return "", fmt.Errorf("invalid URI %q: path must not contain %q", uri, c)
+		}
+	}
+
+	return host + "/" + path, nil
+}
+
+func validateHostname(host string) error {
+	if host == "" {
+		return fmt.Errorf("missing hostname")
+	}
+	if len(host) > maxHostnameLength {
+		return fmt.Errorf("hostname is longer than %d characters", maxHostnameLength)
+	}
+
+	labels := strings.Split(host, ".")
+	if labels[0] == "*" {
+		if len(labels) < 3 {
+			return fmt.Errorf("wildcard must be followed by at least two labels")
+		}
+		labels = labels[1:]
+	}
+
+	for _, label := range labels {
+		err := validateLabel(label)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("hostname must not contain empty labels")
+	}
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label %q is longer than %d characters", label, maxLabelLength)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label %q must not start or end with a hyphen", label)
+	}
+
+	for _, c := range label {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-':
+		case c == '*':
+			return fmt.Errorf("wildcard is only allowed as the first label")
+		default:
+			return fmt.Errorf("label %q contains invalid character %q", label, c)
+		}
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"strconv"
 	"time"
 
 	tls_helpers "code.cloudfoundry.org/cf-routing-test-helpers/tls"
@@ -402,7 +403,7 @@ func startNatsTLS(host string, port uint16, caFile, certFile, keyFile string) *e
 	natsTimeout := 10 * time.Second
 	natsPollingInterval := 20 * time.Millisecond
 	Eventually(func() error {
-		_, err := net.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
+		_, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
 		return err
 	}, natsTimeout, natsPollingInterval).Should(Succeed())
 
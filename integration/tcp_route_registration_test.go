@@ -49,7 +49,7 @@ var _ = Describe("TCP Route Registration", func() {
 					"guid": "router-group-guid",
 					"name": "my-router-group",
 					"type": "tcp",
-					"reservable_ports": "1024-1025"
+					"reservable_ports": "1024-1025,5678"
 				}]`),
 			),
 			ghttp.CombineHandlers(
@@ -154,9 +154,9 @@ var _ = Describe("TCP Route Registration", func() {
 		It("registers it with the routing API", func() {
 			Eventually(session.Out).Should(gbytes.Say("Initializing"))
 			Eventually(session.Out).Should(gbytes.Say("creating routing API connection"))
+			Eventually(session.Out).Should(gbytes.Say("Mapped new router group"))
 			Eventually(session.Out).Should(gbytes.Say("Writing pid"))
 			Eventually(session.Out).Should(gbytes.Say("Running"))
-			Eventually(session.Out).Should(gbytes.Say("Mapped new router group"))
 			Eventually(session.Out).Should(gbytes.Say("Upserted route"))
 		})
 		Context("when UAA errors intermittently occur", func() {
@@ -235,9 +235,9 @@ var _ = Describe("TCP Route Registration", func() {
 			It("registers it with the routing API", func() {
 				Eventually(session.Out).Should(gbytes.Say("Initializing"))
 				Eventually(session.Out).Should(gbytes.Say("creating routing API connection"))
+				Eventually(session.Out).Should(gbytes.Say("Mapped new router group"))
 				Eventually(session.Out).Should(gbytes.Say("Writing pid"))
 				Eventually(session.Out).Should(gbytes.Say("Running"))
-				Eventually(session.Out).Should(gbytes.Say("Mapped new router group"))
 				Eventually(session.Out).Should(gbytes.Say("Upserted route"))
 				// Upserted Route content verified with expected body in the ghttp server setup
 			})
@@ -0,0 +1,212 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/route-registrar/config"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("validate", func() {
+	var (
+		rootConfig config.ConfigSchema
+		dynamicDir string
+	)
+
+	type validationResult struct {
+		Valid         bool `json:"valid"`
+		Routes        int  `json:"routes"`
+		DynamicRoutes int  `json:"dynamic_routes"`
+		Errors        []struct {
+			Source string `json:"source"`
+			Error  string `json:"error"`
+		} `json:"errors"`
+		Skipped []string `json:"skipped"`
+	}
+
+	validate := func(args ...string) *gexec.Session {
+		command := exec.Command(routeRegistrarBinPath, append([]string{"validate", fmt.Sprintf("-configPath=%s", configFile)}, args...)...)
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		Eventually(session, 10*time.Second).Should(gexec.Exit())
+		return session
+	}
+
+	writeDynamicConfig := func(name, contents string) string {
+		path := filepath.Join(dynamicDir, name)
+		Expect(os.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dynamicDir, err = os.MkdirTemp(tempDir, "dynamic-config-")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		rootConfig = initConfig()
+		rootConfig.DynamicConfigGlobs = []string{filepath.Join(dynamicDir, "*.yml")}
+
+		writeDynamicConfig("routes.yml", `
+routes:
+- name: dynamic-route
+  port: 8080
+  uris: [dynamic.apps.example.com]
+  registration_interval: 1s
+`)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dynamicDir)).To(Succeed())
+	})
+
+	It("exits successfully for a valid config", func() {
+		writeConfig(rootConfig)
+
+		session := validate()
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`is valid: 1 static and 1 dynamic routes`))
+	})
+
+	It("reports errors of the main config", func() {
+		rootConfig.Routes[0].RegistrationInterval = ""
+		rootConfig.Routes[0].URIs = []string{"http://uri-1"}
+		writeConfig(rootConfig)
+
+		session := validate()
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Out).To(gbytes.Say(`registrar_settings.json:`))
+		Expect(session.Out).To(gbytes.Say(`there were 2 errors with 'route "My route"'`))
+		Expect(session.Out).To(gbytes.Say(`is invalid`))
+	})
+
+	It("reports errors of dynamic config files and missing referenced files", func() {
+		rootConfig.Routes[0].HealthCheck = &config.HealthCheckSchema{
+			Name:       "health-check",
+			ScriptPath: filepath.Join(dynamicDir, "missing-script.sh"),
+		}
+		writeConfig(rootConfig)
+
+		invalidFile := writeDynamicConfig("invalid.yml", `
+routes:
+- name: invalid-route
+  uris: [invalid.apps.example.com]
+  registration_interval: 1s
+`)
+
+		session := validate()
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Out).To(gbytes.Say(fmt.Sprintf(`%s:\n  .*'route "invalid-route"'`, invalidFile)))
+		Expect(session.Out).To(gbytes.Say(`health_check.script_path of route "My route": .*missing-script.sh`))
+	})
+
+	It("reports what depends on the machine as not checked instead of as errors", func() {
+		rootConfig.Host = ""
+		rootConfig.HostInterface = "does-not-exist0"
+		rootConfig.MessageBusServers[0].Password = "${ROUTE_REGISTRAR_VALIDATE_UNSET}"
+		writeConfig(rootConfig)
+
+		session := validate()
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`not checked, as it depends on the machine the route-registrar runs on:`))
+		Expect(session.Out).To(gbytes.Say(`message_bus_servers\[0\].password: \$\{ROUTE_REGISTRAR_VALIDATE_UNSET\} not resolved`))
+		Expect(session.Out).To(gbytes.Say(`host: not detected from host_interface "does-not-exist0"`))
+		Expect(session.Out).To(gbytes.Say(`is valid: 1 static and 1 dynamic routes`))
+	})
+
+	It("still checks the syntax of the host detection", func() {
+		rootConfig.Host = ""
+		rootConfig.HostCIDR = "10.0.0.0"
+		writeConfig(rootConfig)
+
+		session := validate()
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Out).To(gbytes.Say(`invalid host_cidr`))
+	})
+
+	It("continues with the dynamic config files after errors of the main config", func() {
+		rootConfig.Routes[0].RegistrationInterval = ""
+		writeConfig(rootConfig)
+
+		invalidFile := writeDynamicConfig("invalid.yml", `
+routes:
+- name: invalid-route
+  uris: [invalid.apps.example.com]
+  registration_interval: 1s
+`)
+
+		session := validate()
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Out).To(gbytes.Say(`no registration_interval`))
+		Expect(session.Out).To(gbytes.Say(fmt.Sprintf(`%s:\n  .*'route "invalid-route"'`, invalidFile)))
+	})
+
+	It("validates the dynamic config files matching --dynamic-glob when the main config cannot be parsed", func() {
+		Expect(os.WriteFile(configFile, []byte("{not json"), 0644)).To(Succeed())
+		otherFile := writeDynamicConfig("other.yaml", `
+routes:
+- name: other-route
+`)
+
+		session := validate("--dynamic-glob", filepath.Join(dynamicDir, "*.yaml"))
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Out).To(gbytes.Say(`registrar_settings.json:`))
+		Expect(session.Out).To(gbytes.Say(fmt.Sprintf(`%s:`, otherFile)))
+	})
+
+	It("validates the dynamic config files matching --dynamic-glob instead", func() {
+		writeConfig(rootConfig)
+		otherFile := writeDynamicConfig("other.yaml", `
+routes:
+- name: other-route
+`)
+
+		session := validate("--dynamic-glob", filepath.Join(dynamicDir, "*.yaml"))
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Out).To(gbytes.Say(fmt.Sprintf(`%s:`, otherFile)))
+	})
+
+	It("prints the result as JSON", func() {
+		rootConfig.Routes[0].Port = nil
+		writeConfig(rootConfig)
+
+		session := validate("-format", "json")
+		Expect(session).To(gexec.Exit(1))
+
+		var result validationResult
+		Expect(json.Unmarshal(session.Out.Contents(), &result)).To(Succeed())
+		Expect(result.Valid).To(BeFalse())
+		Expect(result.Errors).To(HaveLen(1))
+		Expect(result.Errors[0].Source).To(Equal(configFile))
+		Expect(result.Errors[0].Error).To(ContainSubstring("no port"))
+	})
+
+	It("prints what was not checked in the JSON result", func() {
+		rootConfig.MessageBusServers[0].Password = "${ROUTE_REGISTRAR_VALIDATE_UNSET}"
+		writeConfig(rootConfig)
+
+		session := validate("-format", "json")
+		Expect(session).To(gexec.Exit(0))
+
+		var result validationResult
+		Expect(json.Unmarshal(session.Out.Contents(), &result)).To(Succeed())
+		Expect(result.Valid).To(BeTrue())
+		Expect(result.Skipped).To(ConsistOf("message_bus_servers[0].password: ${ROUTE_REGISTRAR_VALIDATE_UNSET} not resolved"))
+	})
+
+	It("exits with 2 for an unknown format", func() {
+		writeConfig(rootConfig)
+
+		session := validate("-format", "xml")
+		Expect(session).To(gexec.Exit(2))
+		Expect(session.Err).To(gbytes.Say(`unknown format "xml"`))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"expvar"
 	"flag"
 	"log"
 	"net/http"
@@ -22,21 +23,27 @@ import (
 	"code.cloudfoundry.org/route-registrar/messagebus"
 	"code.cloudfoundry.org/route-registrar/registrar"
 	"code.cloudfoundry.org/route-registrar/routingapi"
+	"code.cloudfoundry.org/route-registrar/tlsreloader"
 	routing_api "code.cloudfoundry.org/routing-api"
 	"code.cloudfoundry.org/routing-api/uaaclient"
-	"code.cloudfoundry.org/tlsconfig"
 
 	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/http_server"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	var configPath string
 	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
 	pidfile := flags.String("pidfile", "", "Path to pid file")
 	lagerflags.AddFlags(flags)
 
-	flags.StringVar(&configPath, "configPath", "", "path to configuration file with json encoded content")
+	flags.StringVar(&configPath, "configPath", "", "path to JSON or YAML configuration file")
 	err := flags.Set("configPath", "registrar_settings.yml")
 	if err != nil {
 		log.Fatalf("Failed to set up configPath flag")
@@ -63,7 +70,10 @@ func main() {
 	logger.Info("creating nats connection")
 	messageBus := messagebus.NewMessageBus(logger, c.AvailabilityZone)
 
+	clk := clock.NewClock()
+
 	var routingAPI *routingapi.RoutingAPI
+	var routingAPIReloader *tlsreloader.Reloader
 	if c.RoutingAPI.APIURL != "" {
 		logger.Info("creating routing API connection")
 
@@ -108,22 +118,80 @@ func main() {
 			CACerts:           c.RoutingAPI.CACerts,
 			TokenEndpoint:     oauthUrl.Hostname(),
 		}
-		clk := clock.NewClock()
 		uaaClient, err := uaaclient.NewTokenFetcher(false, uaaConfig, clk, 3, 500*time.Millisecond, 30, logger)
 		if err != nil {
 			log.Fatalln(err)
 		}
 
-		apiClient, err := newAPIClient(c)
+		apiClient, reloader, err := newAPIClient(logger, clk, c)
 
 		if err != nil {
 			logger.Fatal("failed-to-create-tls-config", err)
 		}
+		routingAPIReloader = reloader
+
+		routingAPI = routingapi.NewRoutingAPI(logger, clk, uaaClient, apiClient, c.RoutingAPI.MaxTTL)
+		if routingAPIReloader != nil {
+			// A rotated CA is only used by a client with a new TLS config.
+			routingAPIReloader.OnReload(func() {
+				apiURL, _ := url.Parse(c.RoutingAPI.APIURL)
+				apiClient, err := newTLSAPIClient(routingAPIReloader, c.RoutingAPI.APIURL, apiURL.Hostname())
+				if err != nil {
+					logger.Error("failed-to-create-routing-api-client", err)
+					return
+				}
+				routingAPI.SetAPIClient(apiClient)
+			})
+		}
+
+		err = routingAPI.ValidateRouterGroupPorts(c.Routes)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if c.RoutingAPI.ReconcileStaleTCPRoutes {
+			reconcileTcpRouteMappings(logger, c, routingAPI)
+		}
+	}
 
-		routingAPI = routingapi.NewRoutingAPI(logger, uaaClient, apiClient, c.RoutingAPI.MaxTTL)
+	var r ifrit.Runner
+	if routingAPI != nil {
+		// Members are stopped in reverse order, so the registrar is stopped
+		// first and the routes it unregisters on exit still reach the routing
+		// API.
+		members := grouper.Members{{Name: "routing-api", Runner: routingAPI}}
+		if routingAPIReloader != nil {
+			members = append(grouper.Members{{Name: "routing-api-tls-reloader", Runner: routingAPIReloader}}, members...)
+		}
+		if c.RoutingAPI.WatchTCPRouteEvents {
+			members = append(members, grouper.Member{Name: "routing-api-tcp-event-watcher", Runner: routingapi.NewTcpEventWatcher(logger, routingAPI, clk)})
+		}
+		if c.RoutingAPI.BatchWindow > 0 {
+			batcher := routingapi.NewBatcher(logger, routingAPI, clk, c.RoutingAPI.BatchWindow)
+			members = append(members,
+				grouper.Member{Name: "routing-api-batcher", Runner: batcher},
+				grouper.Member{Name: "registrar", Runner: registrar.NewRegistrar(*c, hc, logger, messageBus, batcher, 10*time.Second)},
+			)
+		} else {
+			members = append(members,
+				grouper.Member{Name: "registrar", Runner: registrar.NewRegistrar(*c, hc, logger, messageBus, routingAPI, 10*time.Second)},
+			)
+		}
+		r = grouper.NewOrdered(os.Interrupt, members)
+	} else {
+		r = registrar.NewRegistrar(*c, hc, logger, messageBus, routingAPI, 10*time.Second)
 	}
 
-	r := registrar.NewRegistrar(*c, hc, logger, messageBus, routingAPI, 10*time.Second)
+	if c.DebugAddress != "" {
+		// The debug server publishes the expvar metrics, e.g. the certificate
+		// expiry, and is stopped last.
+		debugHandler := http.NewServeMux()
+		debugHandler.Handle("/debug/vars", expvar.Handler())
+		r = grouper.NewOrdered(os.Interrupt, grouper.Members{
+			{Name: "debug-server", Runner: http_server.New(c.DebugAddress, debugHandler)},
+			{Name: "route-registrar", Runner: r},
+		})
+	}
 
 	if *pidfile != "" {
 		pid := strconv.Itoa(os.Getpid())
@@ -162,29 +230,60 @@ func main() {
 	}
 }
 
-func newAPIClient(c *config.Config) (routing_api.Client, error) {
+// reconcileTcpRouteMappings removes the mappings left behind by a previous
+// run. Failures are logged but do not prevent the registrar from starting.
+func reconcileTcpRouteMappings(logger lager.Logger, c *config.Config, routingAPI *routingapi.RoutingAPI) {
+	dynamicRoutes, err := registrar.DynamicRoutes(logger, *c)
+	if err != nil {
+		logger.Error("failed-to-discover-dynamic-routes", err)
+		return
+	}
+
+	routes := append(append([]config.Route{}, c.Routes...), dynamicRoutes...)
+	err = routingAPI.ReconcileTcpRouteMappings(c.Host, routes, c.RoutingAPI.ReconcileDryRun)
+	if err != nil {
+		logger.Error("failed-to-reconcile-tcp-route-mappings", err)
+	}
+}
+
+func newAPIClient(logger lager.Logger, clk clock.Clock, c *config.Config) (routing_api.Client, *tlsreloader.Reloader, error) {
 	apiURL, err := url.Parse(c.RoutingAPI.APIURL)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	var client routing_api.Client
+	if apiURL.Scheme != "https" {
+		return routing_api.NewClient(c.RoutingAPI.APIURL, c.RoutingAPI.SkipSSLValidation), nil, nil
+	}
 
-	if apiURL.Scheme == "https" {
-		routingAPITLSConfig, err := tlsconfig.Build(
-			tlsconfig.WithInternalServiceDefaults(),
-			tlsconfig.WithIdentityFromFile(c.RoutingAPI.ClientCertificatePath, c.RoutingAPI.ClientPrivateKeyPath),
-		).Client(
-			tlsconfig.WithAuthorityFromFile(c.RoutingAPI.ServerCACertificatePath),
-		)
-		if err != nil {
-			return nil, err
-		}
+	reloader, err := tlsreloader.NewReloader(
+		logger.Session("routing-api"),
+		clk,
+		c.RoutingAPI.ClientCertificatePath,
+		c.RoutingAPI.ClientPrivateKeyPath,
+		c.RoutingAPI.ServerCACertificatePath,
+		c.CertificateReloadInterval,
+		c.CertificateExpiryWarning,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		client = routing_api.NewClientWithTLSConfig(c.RoutingAPI.APIURL, routingAPITLSConfig)
-	} else {
-		client = routing_api.NewClient(c.RoutingAPI.APIURL, c.RoutingAPI.SkipSSLValidation)
+	apiClient, err := newTLSAPIClient(reloader, c.RoutingAPI.APIURL, apiURL.Hostname())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return apiClient, reloader, nil
+}
+
+// newTLSAPIClient creates a routing API client that verifies the server
+// against the CA pool the reloader currently holds.
+func newTLSAPIClient(reloader *tlsreloader.Reloader, apiURL string, serverName string) (routing_api.Client, error) {
+	routingAPITLSConfig, err := reloader.ClientTLSConfig(serverName)
+	if err != nil {
+		return nil, err
 	}
 
-	return client, nil
+	return routing_api.NewClientWithTLSConfig(apiURL, routingAPITLSConfig), nil
 }
@@ -2,10 +2,14 @@ package messagebus
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -17,7 +21,7 @@ import (
 //go:generate counterfeiter . MessageBus
 
 type MessageBus interface {
-	Connect(servers []config.MessageBusServer, tlsConfig *tls.Config) error
+	Connect(servers []config.MessageBusServer, tlsConfig *tls.Config, rootCAs func() (*x509.CertPool, error)) error
 	SendMessage(subject string, route config.Route, privateInstanceId string) error
 	Close()
 }
@@ -26,48 +30,101 @@ type msgBus struct {
 	natsHost         *atomic.Value
 	natsConn         *nats.Conn
 	availabilityZone string
+	endpointUpdates  *endpointUpdates
 	logger           lager.Logger
 }
 
+// endpointUpdates holds when the registration of each endpoint last changed,
+// keyed by the registration message without the time. The periodic
+// registrations of an unchanged endpoint keep the time it was first
+// registered with, while a changed route, or a route registered again after
+// it was unregistered, e.g. by a failing health check, gets a new time.
+type endpointUpdates struct {
+	lock        sync.Mutex
+	updatedAtNs map[string]int64
+}
+
+func (e *endpointUpdates) updatedAt(subject string, key string) int64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if subject == UnregisterSubject {
+		delete(e.updatedAtNs, key)
+		return time.Now().UnixNano()
+	}
+
+	updatedAtNs, ok := e.updatedAtNs[key]
+	if !ok {
+		updatedAtNs = time.Now().UnixNano()
+		e.updatedAtNs[key] = updatedAtNs
+	}
+	return updatedAtNs
+}
+
 type Message struct {
-	URIs                []string          `json:"uris"`
-	Host                string            `json:"host"`
-	Protocol            string            `json:"protocol,omitempty"`
-	Port                *uint16           `json:"port,omitempty"`
-	TLSPort             *uint16           `json:"tls_port,omitempty"`
-	Tags                map[string]string `json:"tags"`
-	RouteServiceUrl     string            `json:"route_service_url,omitempty"`
-	PrivateInstanceId   string            `json:"private_instance_id"`
-	ServerCertDomainSAN string            `json:"server_cert_domain_san,omitempty"`
-	AvailabilityZone    string            `json:"availability_zone,omitempty"`
-	Options             map[string]string `json:"options,omitempty"`
+	URIs                    []string          `json:"uris"`
+	Host                    string            `json:"host"`
+	Protocol                string            `json:"protocol,omitempty"`
+	Port                    *uint16           `json:"port,omitempty"`
+	TLSPort                 *uint16           `json:"tls_port,omitempty"`
+	Tags                    map[string]string `json:"tags"`
+	RouteServiceUrl         string            `json:"route_service_url,omitempty"`
+	PrivateInstanceId       string            `json:"private_instance_id"`
+	PrivateInstanceIndex    string            `json:"private_instance_index,omitempty"`
+	App                     string            `json:"app,omitempty"`
+	IsolationSegment        string            `json:"isolation_segment,omitempty"`
+	StaleThresholdInSeconds int               `json:"stale_threshold_in_seconds,omitempty"`
+	EndpointUpdatedAtNs     int64             `json:"endpoint_updated_at_ns,omitempty"`
+	ServerCertDomainSAN     string            `json:"server_cert_domain_san,omitempty"`
+	AvailabilityZone        string            `json:"availability_zone,omitempty"`
+	Options                 map[string]string `json:"options,omitempty"`
 }
 
-const LoadBalancingAlgorithm string = "loadbalancing"
+const (
+	LoadBalancingAlgorithm string = "loadbalancing"
+	HashHeader             string = "hash_header"
+	HashBalance            string = "hash_balance"
+
+	RegisterSubject   string = "router.register"
+	UnregisterSubject string = "router.unregister"
+)
 
 func NewMessageBus(logger lager.Logger, availabilityZone string) MessageBus {
 	return &msgBus{
 		logger:           logger,
 		natsHost:         &atomic.Value{},
 		availabilityZone: availabilityZone,
+		endpointUpdates:  &endpointUpdates{updatedAtNs: map[string]int64{}},
 	}
 }
 
-func (m *msgBus) Connect(servers []config.MessageBusServer, tlsConfig *tls.Config) error {
+// Connect connects to the NATS servers. When rootCAs is set, it is called on
+// every connect and reconnect for the CA pool to verify the servers with, so
+// that a rotated CA is used without restarting.
+func (m *msgBus) Connect(servers []config.MessageBusServer, tlsConfig *tls.Config, rootCAs func() (*x509.CertPool, error)) error {
 
 	var natsServers []string
 	var natsHosts []string
 	for _, server := range servers {
-		natsServers = append(
-			natsServers,
-			fmt.Sprintf("nats://%s:%s@%s", server.User, server.Password, server.Host),
-		)
-		natsHosts = append(natsHosts, server.Host)
+		// IPv6 addresses must be enclosed in brackets, e.g. [::1]:4222.
+		host, port, err := net.SplitHostPort(server.Host)
+		if err != nil {
+			return fmt.Errorf("invalid message bus server host %q: %s", server.Host, err)
+		}
+
+		natsURL := url.URL{
+			Scheme: "nats",
+			User:   url.UserPassword(server.User, server.Password),
+			Host:   net.JoinHostPort(host, port),
+		}
+		natsServers = append(natsServers, natsURL.String())
+		natsHosts = append(natsHosts, natsURL.Host)
 	}
 
 	opts := nats.GetDefaultOptions()
 	opts.Servers = natsServers
 	opts.TLSConfig = tlsConfig
+	opts.RootCAsCB = rootCAs
 	opts.PingInterval = 20 * time.Second
 
 	opts.ClosedCB = func(conn *nats.Conn) {
@@ -110,19 +167,35 @@ func (m msgBus) SendMessage(subject string, route config.Route, privateInstanceI
 
 	routeOptions := m.mapRouteOptions(route)
 
+	availabilityZone := m.availabilityZone
+	if route.AvailabilityZone != "" {
+		availabilityZone = route.AvailabilityZone
+	}
+
 	msg := &Message{
-		URIs:                route.URIs,
-		Host:                route.Host,
-		Port:                route.Port,
-		Protocol:            route.Protocol,
-		TLSPort:             route.TLSPort,
-		Tags:                route.Tags,
-		RouteServiceUrl:     route.RouteServiceUrl,
-		ServerCertDomainSAN: route.ServerCertDomainSAN,
-		PrivateInstanceId:   privateInstanceId,
-		AvailabilityZone:    m.availabilityZone,
-		Options:             routeOptions,
+		URIs:                    route.URIs,
+		Host:                    route.Host,
+		Port:                    route.Port,
+		Protocol:                route.Protocol,
+		TLSPort:                 route.TLSPort,
+		Tags:                    route.Tags,
+		RouteServiceUrl:         route.RouteServiceUrl,
+		ServerCertDomainSAN:     route.ServerCertDomainSAN,
+		PrivateInstanceId:       privateInstanceId,
+		PrivateInstanceIndex:    route.PrivateInstanceIndex,
+		App:                     route.App,
+		IsolationSegment:        route.IsolationSegment,
+		StaleThresholdInSeconds: route.StaleThresholdInSeconds,
+		AvailabilityZone:        availabilityZone,
+		Options:                 routeOptions,
+	}
+
+	endpoint, err := json.Marshal(msg)
+	if err != nil {
+		// Untested as we cannot force json.Marshal to return error.
+		return err
 	}
+	msg.EndpointUpdatedAtNs = m.endpointUpdates.updatedAt(subject, string(endpoint))
 
 	json, err := json.Marshal(msg)
 	if err != nil {
@@ -141,6 +214,15 @@ func (m msgBus) mapRouteOptions(route config.Route) map[string]string {
 		if route.Options.LoadBalancingAlgorithm != "" {
 			routeOptions[LoadBalancingAlgorithm] = string(route.Options.LoadBalancingAlgorithm)
 		}
+		if route.Options.HashHeader != "" {
+			routeOptions[HashHeader] = route.Options.HashHeader
+		}
+		if route.Options.HashBalance != 0 {
+			routeOptions[HashBalance] = strconv.FormatFloat(route.Options.HashBalance, 'f', -1, 64)
+		}
+		for key, value := range route.Options.Unknown {
+			routeOptions[key] = value
+		}
 		return routeOptions
 	}
 	return nil
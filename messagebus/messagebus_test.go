@@ -2,12 +2,14 @@ package messagebus_test
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 	"strconv"
+	"sync"
 	"time"
 
 	tls_helpers "code.cloudfoundry.org/cf-routing-test-helpers/tls"
@@ -92,7 +94,7 @@ var _ = Describe("Messagebus test Suite", func() {
 
 	Describe("Connect", func() {
 		It("connects without error", func() {
-			err := messageBus.Connect(messageBusServers, nil)
+			err := messageBus.Connect(messageBusServers, nil, nil)
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 
@@ -182,9 +184,82 @@ var _ = Describe("Messagebus test Suite", func() {
 				)
 				Expect(err).NotTo(HaveOccurred())
 
-				err = messageBus.Connect(tlsMessageBusServers, clientTlsConfig)
+				err = messageBus.Connect(tlsMessageBusServers, clientTlsConfig, nil)
 				Expect(err).NotTo(HaveOccurred())
 			})
+
+			It("verifies the server against the current CA pool when it reconnects", func() {
+				var lock sync.Mutex
+				clientCert := mtlsNATSClientCert
+				rootCAs := caPool(natsCAPath)
+
+				clientTlsConfig, err := tlsconfig.Build(tlsconfig.WithInternalServiceDefaults()).Client()
+				Expect(err).NotTo(HaveOccurred())
+				clientTlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					lock.Lock()
+					defer lock.Unlock()
+					return &clientCert, nil
+				}
+
+				err = messageBus.Connect(tlsMessageBusServers, clientTlsConfig, func() (*x509.CertPool, error) {
+					lock.Lock()
+					defer lock.Unlock()
+					return rootCAs, nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(logger).Should(gbytes.Say("nats-connection-successful"))
+
+				Expect(natsTlsCmd.Process.Kill()).To(Succeed())
+				_, err = natsTlsCmd.Process.Wait()
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(logger).Should(gbytes.Say("nats-connection-disconnected"))
+
+				rotatedCAPath, rotatedServerCertPath, rotatedServerKeyPath, rotatedClientCert := tls_helpers.GenerateCaAndMutualTlsCerts()
+				lock.Lock()
+				clientCert = rotatedClientCert
+				rootCAs = caPool(rotatedCAPath)
+				lock.Unlock()
+
+				natsTlsCmd = startNatsTls(natsTlsHost, natsTlsPort, rotatedCAPath, rotatedServerCertPath, rotatedServerKeyPath, "testuser", "testpw")
+				Eventually(logger, 10*time.Second).Should(gbytes.Say("nats-connection-reconnected"))
+			})
+		})
+
+		Context("when the nats server listens on the IPv6 loopback", func() {
+			var (
+				natsIPv6Port int
+				natsIPv6Cmd  *exec.Cmd
+			)
+
+			BeforeEach(func() {
+				natsIPv6Port = natsPort + 2000
+				natsIPv6Cmd = startNats("::1", natsIPv6Port, natsUsername, natsPassword, "-a", "::1")
+			})
+
+			AfterEach(func() {
+				err := natsIPv6Cmd.Process.Kill()
+				Expect(err).NotTo(HaveOccurred())
+				_, err = natsIPv6Cmd.Process.Wait()
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("connects to the bracketed address", func() {
+				err := messageBus.Connect([]config.MessageBusServer{{
+					Host:     net.JoinHostPort("::1", strconv.Itoa(natsIPv6Port)),
+					User:     natsUsername,
+					Password: natsPassword,
+				}}, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(logger).Should(gbytes.Say(`nats-connection-successful`))
+				Eventually(logger).Should(gbytes.Say(`\[::1\]`))
+			})
+		})
+
+		Context("when a server host has no port", func() {
+			It("returns error", func() {
+				err := messageBus.Connect([]config.MessageBusServer{{Host: "::1"}}, nil, nil)
+				Expect(err).To(MatchError(ContainSubstring(`invalid message bus server host "::1"`)))
+			})
 		})
 
 		Context("when no servers are provided", func() {
@@ -193,14 +268,14 @@ var _ = Describe("Messagebus test Suite", func() {
 			})
 
 			It("returns error", func() {
-				err := messageBus.Connect(messageBusServers, nil)
+				err := messageBus.Connect(messageBusServers, nil, nil)
 				Expect(err).Should(HaveOccurred())
 			})
 		})
 
 		Context("when nats connection is successful", func() {
 			BeforeEach(func() {
-				err := messageBus.Connect(messageBusServers, nil)
+				err := messageBus.Connect(messageBusServers, nil, nil)
 				Expect(err).ShouldNot(HaveOccurred())
 			})
 			It("logs a message", func() {
@@ -211,7 +286,7 @@ var _ = Describe("Messagebus test Suite", func() {
 
 		Context("when nats connection closes", func() {
 			BeforeEach(func() {
-				err := messageBus.Connect(messageBusServers, nil)
+				err := messageBus.Connect(messageBusServers, nil, nil)
 				Expect(err).ShouldNot(HaveOccurred())
 				messageBus.Close()
 			})
@@ -236,7 +311,7 @@ var _ = Describe("Messagebus test Suite", func() {
 		)
 
 		BeforeEach(func() {
-			err := messageBus.Connect(messageBusServers, nil)
+			err := messageBus.Connect(messageBusServers, nil, nil)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			port := uint16(12345)
@@ -295,9 +370,36 @@ var _ = Describe("Messagebus test Suite", func() {
 			Expect(registryMessage.AvailabilityZone).To(Equal(expectedRegistryMessage.AvailabilityZone))
 		})
 
+		Context("when the route has an availability zone", func() {
+			BeforeEach(func() {
+				route.AvailabilityZone = "route-az"
+			})
+
+			It("sends it instead of the global availability zone", func() {
+				registered := make(chan string)
+				testSpyClient.Subscribe(topic, func(msg *nats.Msg) {
+					registered <- string(msg.Data)
+				})
+
+				// Wait for the nats library to register our callback.
+				time.Sleep(20 * time.Millisecond)
+
+				err := messageBus.SendMessage(topic, route, privateInstanceId)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				var receivedMessage string
+				Eventually(registered, 2).Should(Receive(&receivedMessage))
+
+				var registryMessage messagebus.Message
+				err = json.Unmarshal([]byte(receivedMessage), &registryMessage)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(registryMessage.AvailabilityZone).To(Equal("route-az"))
+			})
+		})
+
 		Context("when the connection is already closed", func() {
 			BeforeEach(func() {
-				err := messageBus.Connect(messageBusServers, nil)
+				err := messageBus.Connect(messageBusServers, nil, nil)
 				Expect(err).ShouldNot(HaveOccurred())
 
 				messageBus.Close()
@@ -321,7 +423,7 @@ var _ = Describe("Messagebus test Suite", func() {
 		)
 
 		BeforeEach(func() {
-			err := messageBus.Connect(messageBusServers, nil)
+			err := messageBus.Connect(messageBusServers, nil, nil)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			port := uint16(12345)
@@ -381,6 +483,119 @@ var _ = Describe("Messagebus test Suite", func() {
 			Expect(registryMessage.Tags).To(Equal(expectedRegistryMessage.Tags))
 		})
 	})
+	Describe("SendMessage with gorouter metadata", func() {
+		const (
+			topic             = "router.registrar"
+			privateInstanceId = "some_id"
+		)
+
+		var (
+			route config.Route
+		)
+
+		BeforeEach(func() {
+			err := messageBus.Connect(messageBusServers, nil, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			port := uint16(12345)
+
+			route = config.Route{
+				Name:                    "some_name",
+				Port:                    &port,
+				Host:                    "some_host",
+				URIs:                    []string{"uri1", "uri2"},
+				App:                     "some-app-guid",
+				PrivateInstanceIndex:    "2",
+				IsolationSegment:        "some-iso-seg",
+				StaleThresholdInSeconds: 120,
+			}
+		})
+
+		It("sends messages", func() {
+			registered := make(chan string)
+			testSpyClient.Subscribe(topic, func(msg *nats.Msg) {
+				registered <- string(msg.Data)
+			})
+
+			// Wait for the nats library to register our callback.
+			// We use a sleep because there's no way to know that the callback was
+			// registered successfully (e.g. they don't provide a channel)
+			time.Sleep(20 * time.Millisecond)
+
+			err := messageBus.SendMessage(topic, route, privateInstanceId)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			var receivedMessage string
+			Eventually(registered, 2).Should(Receive(&receivedMessage))
+
+			var registryMessage messagebus.Message
+			err = json.Unmarshal([]byte(receivedMessage), &registryMessage)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(registryMessage.App).To(Equal("some-app-guid"))
+			Expect(registryMessage.PrivateInstanceId).To(Equal(privateInstanceId))
+			Expect(registryMessage.PrivateInstanceIndex).To(Equal("2"))
+			Expect(registryMessage.IsolationSegment).To(Equal("some-iso-seg"))
+			Expect(registryMessage.StaleThresholdInSeconds).To(Equal(120))
+			Expect(registryMessage.EndpointUpdatedAtNs).To(BeNumerically(">", 0))
+		})
+
+		Describe("the endpoint update time", func() {
+			var registered chan messagebus.Message
+
+			send := func(subject string, route config.Route) int64 {
+				Expect(messageBus.SendMessage(subject, route, privateInstanceId)).To(Succeed())
+
+				var message messagebus.Message
+				Eventually(registered, 2).Should(Receive(&message))
+				return message.EndpointUpdatedAtNs
+			}
+
+			BeforeEach(func() {
+				registered = make(chan messagebus.Message, 1)
+				for _, subject := range []string{messagebus.RegisterSubject, messagebus.UnregisterSubject} {
+					_, err := testSpyClient.Subscribe(subject, func(msg *nats.Msg) {
+						var message messagebus.Message
+						Expect(json.Unmarshal(msg.Data, &message)).To(Succeed())
+						registered <- message
+					})
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				time.Sleep(20 * time.Millisecond)
+			})
+
+			It("stays the same while the registration does not change", func() {
+				first := send(messagebus.RegisterSubject, route)
+				Expect(send(messagebus.RegisterSubject, route)).To(Equal(first))
+			})
+
+			It("is stamped per route", func() {
+				first := send(messagebus.RegisterSubject, route)
+
+				otherRoute := route
+				otherRoute.URIs = []string{"uri3"}
+				Expect(send(messagebus.RegisterSubject, otherRoute)).To(BeNumerically(">", first))
+				Expect(send(messagebus.RegisterSubject, route)).To(Equal(first))
+			})
+
+			It("changes when the route changes", func() {
+				first := send(messagebus.RegisterSubject, route)
+
+				route.Tags = map[string]string{"component": "changed"}
+				Expect(send(messagebus.RegisterSubject, route)).To(BeNumerically(">", first))
+			})
+
+			It("changes when the route is registered again after it was unregistered", func() {
+				first := send(messagebus.RegisterSubject, route)
+
+				unregistered := send(messagebus.UnregisterSubject, route)
+				Expect(unregistered).To(BeNumerically(">", first))
+				Expect(send(messagebus.RegisterSubject, route)).To(BeNumerically(">", unregistered))
+			})
+		})
+	})
+
 	Describe("SendMessage with per-route options", func() {
 		const (
 			topic             = "router.registrar"
@@ -392,7 +607,7 @@ var _ = Describe("Messagebus test Suite", func() {
 		)
 
 		BeforeEach(func() {
-			err := messageBus.Connect(messageBusServers, nil)
+			err := messageBus.Connect(messageBusServers, nil, nil)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			port := uint16(12345)
@@ -445,9 +660,74 @@ var _ = Describe("Messagebus test Suite", func() {
 			Expect(registryMessage.Options).To(Equal(expectedRegistryMessage.Options))
 		})
 
+		Context("when the route uses hash based load balancing", func() {
+			BeforeEach(func() {
+				route.Options = &config.Options{
+					LoadBalancingAlgorithm: config.Hash,
+					HashHeader:             "X-Tenant-ID",
+					HashBalance:            1.25,
+				}
+			})
+
+			It("sends the hash options", func() {
+				registered := make(chan string)
+				testSpyClient.Subscribe(topic, func(msg *nats.Msg) {
+					registered <- string(msg.Data)
+				})
+
+				time.Sleep(20 * time.Millisecond)
+
+				err := messageBus.SendMessage(topic, route, privateInstanceId)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				var receivedMessage string
+				Eventually(registered, 2).Should(Receive(&receivedMessage))
+
+				var registryMessage messagebus.Message
+				err = json.Unmarshal([]byte(receivedMessage), &registryMessage)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				Expect(registryMessage.Options).To(Equal(map[string]string{
+					"loadbalancing": "hash",
+					"hash_header":   "X-Tenant-ID",
+					"hash_balance":  "1.25",
+				}))
+			})
+		})
+
+		Context("when the route has options unknown to route-registrar", func() {
+			BeforeEach(func() {
+				route.Options.Unknown = map[string]string{"some_new_option": "some-value"}
+			})
+
+			It("forwards them verbatim", func() {
+				registered := make(chan string)
+				testSpyClient.Subscribe(topic, func(msg *nats.Msg) {
+					registered <- string(msg.Data)
+				})
+
+				time.Sleep(20 * time.Millisecond)
+
+				err := messageBus.SendMessage(topic, route, privateInstanceId)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				var receivedMessage string
+				Eventually(registered, 2).Should(Receive(&receivedMessage))
+
+				var registryMessage messagebus.Message
+				err = json.Unmarshal([]byte(receivedMessage), &registryMessage)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				Expect(registryMessage.Options).To(Equal(map[string]string{
+					"loadbalancing":   string(config.LeastConns),
+					"some_new_option": "some-value",
+				}))
+			})
+		})
+
 		Context("when the connection is already closed", func() {
 			BeforeEach(func() {
-				err := messageBus.Connect(messageBusServers, nil)
+				err := messageBus.Connect(messageBusServers, nil, nil)
 				Expect(err).ShouldNot(HaveOccurred())
 
 				messageBus.Close()
@@ -461,7 +741,15 @@ var _ = Describe("Messagebus test Suite", func() {
 	})
 })
 
-func startNats(host string, port int, username, password string) *exec.Cmd {
+func caPool(caPath string) *x509.CertPool {
+	caPEM, err := os.ReadFile(caPath)
+	Expect(err).NotTo(HaveOccurred())
+	pool := x509.NewCertPool()
+	Expect(pool.AppendCertsFromPEM(caPEM)).To(BeTrue())
+	return pool
+}
+
+func startNats(host string, port int, username, password string, args ...string) *exec.Cmd {
 	fmt.Fprintf(GinkgoWriter, "Starting nats-server on port %d\n", port)
 
 	natsServer, exists := os.LookupEnv("NATS_SERVER_BINARY")
@@ -472,9 +760,11 @@ func startNats(host string, port int, username, password string) *exec.Cmd {
 
 	cmd := exec.Command(
 		natsServer,
-		"-p", strconv.Itoa(port),
-		"--user", username,
-		"--pass", password)
+		append([]string{
+			"-p", strconv.Itoa(port),
+			"--user", username,
+			"--pass", password,
+		}, args...)...)
 
 	err := cmd.Start()
 	if err != nil {
@@ -484,7 +774,7 @@ func startNats(host string, port int, username, password string) *exec.Cmd {
 	natsTimeout := 10 * time.Second
 	natsPollingInterval := 20 * time.Millisecond
 	Eventually(func() error {
-		_, err := net.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
+		_, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 		return err
 	}, natsTimeout, natsPollingInterval).Should(Succeed())
 
@@ -519,7 +809,7 @@ func startNatsTls(host string, port int, caFile, certFile, keyFile, username, pa
 	natsTimeout := 10 * time.Second
 	natsPollingInterval := 20 * time.Millisecond
 	Eventually(func() error {
-		_, err := net.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
+		_, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 		return err
 	}, natsTimeout, natsPollingInterval).Should(Succeed())
 
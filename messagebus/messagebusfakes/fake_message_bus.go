@@ -3,6 +3,7 @@ package messagebusfakes
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"sync"
 
 	"code.cloudfoundry.org/route-registrar/config"
@@ -14,11 +15,12 @@ type FakeMessageBus struct {
 	closeMutex       sync.RWMutex
 	closeArgsForCall []struct {
 	}
-	ConnectStub        func([]config.MessageBusServer, *tls.Config) error
+	ConnectStub        func([]config.MessageBusServer, *tls.Config, func() (*x509.CertPool, error)) error
 	connectMutex       sync.RWMutex
 	connectArgsForCall []struct {
 		arg1 []config.MessageBusServer
 		arg2 *tls.Config
+		arg3 func() (*x509.CertPool, error)
 	}
 	connectReturns struct {
 		result1 error
@@ -67,7 +69,7 @@ func (fake *FakeMessageBus) CloseCalls(stub func()) {
 	fake.CloseStub = stub
 }
 
-func (fake *FakeMessageBus) Connect(arg1 []config.MessageBusServer, arg2 *tls.Config) error {
+func (fake *FakeMessageBus) Connect(arg1 []config.MessageBusServer, arg2 *tls.Config, arg3 func() (*x509.CertPool, error)) error {
 	var arg1Copy []config.MessageBusServer
 	if arg1 != nil {
 		arg1Copy = make([]config.MessageBusServer, len(arg1))
@@ -78,13 +80,14 @@ func (fake *FakeMessageBus) Connect(arg1 []config.MessageBusServer, arg2 *tls.Co
 	fake.connectArgsForCall = append(fake.connectArgsForCall, struct {
 		arg1 []config.MessageBusServer
 		arg2 *tls.Config
-	}{arg1Copy, arg2})
+		arg3 func() (*x509.CertPool, error)
+	}{arg1Copy, arg2, arg3})
 	stub := fake.ConnectStub
 	fakeReturns := fake.connectReturns
-	fake.recordInvocation("Connect", []interface{}{arg1Copy, arg2})
+	fake.recordInvocation("Connect", []interface{}{arg1Copy, arg2, arg3})
 	fake.connectMutex.Unlock()
 	if stub != nil {
-		return stub(arg1, arg2)
+		return stub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1
@@ -98,17 +101,17 @@ func (fake *FakeMessageBus) ConnectCallCount() int {
 	return len(fake.connectArgsForCall)
 }
 
-func (fake *FakeMessageBus) ConnectCalls(stub func([]config.MessageBusServer, *tls.Config) error) {
+func (fake *FakeMessageBus) ConnectCalls(stub func([]config.MessageBusServer, *tls.Config, func() (*x509.CertPool, error)) error) {
 	fake.connectMutex.Lock()
 	defer fake.connectMutex.Unlock()
 	fake.ConnectStub = stub
 }
 
-func (fake *FakeMessageBus) ConnectArgsForCall(i int) ([]config.MessageBusServer, *tls.Config) {
+func (fake *FakeMessageBus) ConnectArgsForCall(i int) ([]config.MessageBusServer, *tls.Config, func() (*x509.CertPool, error)) {
 	fake.connectMutex.RLock()
 	defer fake.connectMutex.RUnlock()
 	argsForCall := fake.connectArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
 func (fake *FakeMessageBus) ConnectReturns(result1 error) {
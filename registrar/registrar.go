@@ -2,11 +2,12 @@ package registrar
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"os"
 	"time"
 
-	"code.cloudfoundry.org/tlsconfig"
+	"code.cloudfoundry.org/clock"
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/tedsuo/ifrit"
 
@@ -14,6 +15,7 @@ import (
 	"code.cloudfoundry.org/route-registrar/config"
 	"code.cloudfoundry.org/route-registrar/healthchecker"
 	"code.cloudfoundry.org/route-registrar/messagebus"
+	"code.cloudfoundry.org/route-registrar/tlsreloader"
 
 	"code.cloudfoundry.org/lager/v3"
 )
@@ -22,9 +24,12 @@ type Registrar interface {
 	Run(signals <-chan os.Signal, ready chan<- struct{}) error
 }
 
+//go:generate counterfeiter . api
 type api interface {
 	RegisterRoute(route config.Route) error
 	UnregisterRoute(route config.Route) error
+	RegisterHTTPRoute(route config.Route) error
+	UnregisterHTTPRoute(route config.Route) error
 }
 
 type registrar struct {
@@ -63,22 +68,36 @@ func NewRegistrar(
 func (r *registrar) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 	var err error
 	var tlsConfig *tls.Config
+	var rootCAs func() (*x509.CertPool, error)
 
 	if r.config.NATSmTLSConfig.Enabled {
-		tlsConfig, err = tlsconfig.Build(
-			tlsconfig.WithInternalServiceDefaults(),
-			tlsconfig.WithIdentityFromFile(r.config.NATSmTLSConfig.CertPath, r.config.NATSmTLSConfig.KeyPath),
-		).Client(
-			tlsconfig.WithAuthorityFromFile(r.config.NATSmTLSConfig.CAPath),
+		reloader, err := tlsreloader.NewReloader(
+			r.logger.Session("nats"),
+			clock.NewClock(),
+			r.config.NATSmTLSConfig.CertPath,
+			r.config.NATSmTLSConfig.KeyPath,
+			r.config.NATSmTLSConfig.CAPath,
+			r.config.CertificateReloadInterval,
+			r.config.CertificateExpiryWarning,
 		)
+		if err != nil {
+			return fmt.Errorf("failed building NATS mTLS config: %s", err)
+		}
 
+		// The NATS client sets the server name of each server it connects to.
+		tlsConfig, err = reloader.ClientTLSConfig("")
 		if err != nil {
 			return fmt.Errorf("failed building NATS mTLS config: %s", err)
 		}
+
+		// Reconnects to NATS pick up rotated client certificates and CAs.
+		rootCAs = reloader.RootCAs
+		reloaderProcess := ifrit.Background(reloader)
+		defer reloaderProcess.Signal(os.Interrupt)
 	}
 
 	if len(r.config.MessageBusServers) > 0 {
-		err = r.messageBus.Connect(r.config.MessageBusServers, tlsConfig)
+		err = r.messageBus.Connect(r.config.MessageBusServers, tlsConfig, rootCAs)
 		if err != nil {
 			return err
 		}
@@ -111,7 +130,7 @@ func (r *registrar) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 
 	var routesConfigWatcher ifrit.Runner
 	if len(r.config.DynamicConfigGlobs) > 0 {
-		routesConfigWatcher = NewRoutesConfigWatcher(r.logger, r.dynamicConfigDiscoveryInterval, r.config.DynamicConfigGlobs, r.config.Host, routeDiscovered, routeRemoved)
+		routesConfigWatcher = NewRoutesConfigWatcher(r.logger, r.dynamicConfigDiscoveryInterval, r.config, routeDiscovered, routeRemoved)
 	} else {
 		routesConfigWatcher = NewNoopRoutesConfigWatcher()
 	}
@@ -263,8 +282,10 @@ func (r registrar) registerRoutes(route config.Route) error {
 	var err error
 	if route.Type == "tcp" {
 		err = r.routingAPI.RegisterRoute(route)
+	} else if route.EffectiveTransport(r.config.Transport) == config.TransportRoutingAPI {
+		err = r.routingAPI.RegisterHTTPRoute(route)
 	} else {
-		err = r.messageBus.SendMessage("router.register", route, r.privateInstanceId)
+		err = r.messageBus.SendMessage(messagebus.RegisterSubject, route, r.privateInstanceId)
 	}
 	if err != nil {
 		return err
@@ -281,8 +302,10 @@ func (r registrar) unregisterRoutes(route config.Route) error {
 	var err error
 	if route.Type == "tcp" {
 		err = r.routingAPI.UnregisterRoute(route)
+	} else if route.EffectiveTransport(r.config.Transport) == config.TransportRoutingAPI {
+		err = r.routingAPI.UnregisterHTTPRoute(route)
 	} else {
-		err = r.messageBus.SendMessage("router.unregister", route, r.privateInstanceId)
+		err = r.messageBus.SendMessage(messagebus.UnregisterSubject, route, r.privateInstanceId)
 	}
 	if err != nil {
 		return err
@@ -2,6 +2,7 @@ package registrar_test
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"os"
@@ -21,6 +22,7 @@ import (
 	healthchecker_fakes "code.cloudfoundry.org/route-registrar/healthchecker/fakes"
 	messagebus_fakes "code.cloudfoundry.org/route-registrar/messagebus/messagebusfakes"
 	"code.cloudfoundry.org/route-registrar/registrar"
+	"code.cloudfoundry.org/route-registrar/registrar/registrarfakes"
 )
 
 var _ = Describe("Registrar.RegisterRoutes", func() {
@@ -133,8 +135,9 @@ var _ = Describe("Registrar.RegisterRoutes", func() {
 		<-ready
 
 		Expect(fakeMessageBus.ConnectCallCount()).To(Equal(1))
-		_, passedTLSConfig := fakeMessageBus.ConnectArgsForCall(0)
+		_, passedTLSConfig, passedRootCAs := fakeMessageBus.ConnectArgsForCall(0)
 		Expect(passedTLSConfig).To(BeNil())
+		Expect(passedRootCAs).To(BeNil())
 	})
 
 	Context("when the client TLS config is enabled", func() {
@@ -158,10 +161,47 @@ var _ = Describe("Registrar.RegisterRoutes", func() {
 			Eventually(ready).Should(BeClosed())
 
 			Expect(fakeMessageBus.ConnectCallCount()).To(Equal(1))
-			_, passedTLSConfig := fakeMessageBus.ConnectArgsForCall(0)
+			_, passedTLSConfig, _ := fakeMessageBus.ConnectArgsForCall(0)
 			Expect(passedTLSConfig).NotTo(BeNil())
 		})
 
+		It("passes the CA pool loaded last for the message bus to verify servers on reconnects", func() {
+			rrConfig.CertificateReloadInterval = 10 * time.Millisecond
+			r = registrar.NewRegistrar(rrConfig, fakeHealthChecker, logger, fakeMessageBus, nil, time.Minute)
+
+			runStatus := make(chan error)
+			go func() {
+				runStatus <- r.Run(signals, ready)
+			}()
+			Eventually(ready).Should(BeClosed())
+
+			Expect(fakeMessageBus.ConnectCallCount()).To(Equal(1))
+			_, _, passedRootCAs := fakeMessageBus.ConnectArgsForCall(0)
+			Expect(passedRootCAs).NotTo(BeNil())
+
+			rotatedCAPath, rotatedCertPath, rotatedKeyPath, _ := tls_helpers.GenerateCaAndMutualTlsCerts()
+			for from, to := range map[string]string{
+				rotatedCAPath:   rrConfig.NATSmTLSConfig.CAPath,
+				rotatedCertPath: rrConfig.NATSmTLSConfig.CertPath,
+				rotatedKeyPath:  rrConfig.NATSmTLSConfig.KeyPath,
+			} {
+				contents, err := os.ReadFile(from)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(to, contents, 0600)).To(Succeed())
+			}
+
+			rotatedCA, err := os.ReadFile(rotatedCAPath)
+			Expect(err).NotTo(HaveOccurred())
+			expectedPool := x509.NewCertPool()
+			Expect(expectedPool.AppendCertsFromPEM(rotatedCA)).To(BeTrue())
+
+			Eventually(func() bool {
+				pool, err := passedRootCAs()
+				Expect(err).NotTo(HaveOccurred())
+				return pool.Equal(expectedPool)
+			}).Should(BeTrue())
+		})
+
 		Context("when the client TLS config is invalid", func() {
 			BeforeEach(func() {
 				rrConfig.NATSmTLSConfig.CertPath = "invalid"
@@ -187,7 +227,7 @@ var _ = Describe("Registrar.RegisterRoutes", func() {
 		BeforeEach(func() {
 			err = errors.New("Failed to connect")
 
-			fakeMessageBus.ConnectStub = func([]config.MessageBusServer, *tls.Config) error {
+			fakeMessageBus.ConnectStub = func([]config.MessageBusServer, *tls.Config, func() (*x509.CertPool, error)) error {
 				return err
 			}
 		})
@@ -263,6 +303,78 @@ var _ = Describe("Registrar.RegisterRoutes", func() {
 		})
 	})
 
+	Context("when the transport is routing_api", func() {
+		var fakeAPI *registrarfakes.FakeApi
+
+		BeforeEach(func() {
+			fakeAPI = new(registrarfakes.FakeApi)
+			rrConfig.Transport = config.TransportRoutingAPI
+			rrConfig.MessageBusServers = nil
+			rrConfig.Routes = rrConfig.Routes[:1]
+			r = registrar.NewRegistrar(rrConfig, fakeHealthChecker, logger, fakeMessageBus, fakeAPI, time.Minute)
+		})
+
+		It("registers and unregisters http routes with the routing api", func() {
+			runStatus := make(chan error)
+			go func() {
+				runStatus <- r.Run(signals, ready)
+			}()
+			<-ready
+
+			Eventually(fakeAPI.RegisterHTTPRouteCallCount).Should(BeNumerically(">=", 1))
+			Expect(fakeAPI.RegisterHTTPRouteArgsForCall(0).Name).To(Equal("my route 1"))
+
+			close(signals)
+			Expect(<-runStatus).NotTo(HaveOccurred())
+
+			Expect(fakeAPI.UnregisterHTTPRouteCallCount()).To(Equal(1))
+			Expect(fakeAPI.UnregisterHTTPRouteArgsForCall(0).Name).To(Equal("my route 1"))
+			Expect(fakeAPI.RegisterRouteCallCount()).To(Equal(0))
+			Expect(fakeMessageBus.ConnectCallCount()).To(Equal(0))
+			Expect(fakeMessageBus.SendMessageCallCount()).To(Equal(0))
+		})
+
+		Context("when a route overrides the transport with nats", func() {
+			BeforeEach(func() {
+				rrConfig.Routes[0].Transport = config.TransportNATS
+				r = registrar.NewRegistrar(rrConfig, fakeHealthChecker, logger, fakeMessageBus, fakeAPI, time.Minute)
+			})
+
+			It("registers the route with the message bus", func() {
+				runStatus := make(chan error)
+				go func() {
+					runStatus <- r.Run(signals, ready)
+				}()
+				<-ready
+
+				Eventually(fakeMessageBus.SendMessageCallCount).Should(BeNumerically(">=", 1))
+				close(signals)
+				Expect(<-runStatus).NotTo(HaveOccurred())
+				Expect(fakeAPI.RegisterHTTPRouteCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the route is a tcp route", func() {
+			BeforeEach(func() {
+				rrConfig.Routes[0].Type = "tcp"
+				r = registrar.NewRegistrar(rrConfig, fakeHealthChecker, logger, fakeMessageBus, fakeAPI, time.Minute)
+			})
+
+			It("registers it as a tcp route mapping", func() {
+				runStatus := make(chan error)
+				go func() {
+					runStatus <- r.Run(signals, ready)
+				}()
+				<-ready
+
+				Eventually(fakeAPI.RegisterRouteCallCount).Should(BeNumerically(">=", 1))
+				close(signals)
+				Expect(<-runStatus).NotTo(HaveOccurred())
+				Expect(fakeAPI.RegisterHTTPRouteCallCount()).To(Equal(0))
+			})
+		})
+	})
+
 	Context("on startup", func() {
 		BeforeEach(func() {
 			port := uint16(8080)
@@ -0,0 +1,331 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package registrarfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/route-registrar/config"
+)
+
+type FakeApi struct {
+	RegisterHTTPRouteStub        func(config.Route) error
+	registerHTTPRouteMutex       sync.RWMutex
+	registerHTTPRouteArgsForCall []struct {
+		arg1 config.Route
+	}
+	registerHTTPRouteReturns struct {
+		result1 error
+	}
+	registerHTTPRouteReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RegisterRouteStub        func(config.Route) error
+	registerRouteMutex       sync.RWMutex
+	registerRouteArgsForCall []struct {
+		arg1 config.Route
+	}
+	registerRouteReturns struct {
+		result1 error
+	}
+	registerRouteReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UnregisterHTTPRouteStub        func(config.Route) error
+	unregisterHTTPRouteMutex       sync.RWMutex
+	unregisterHTTPRouteArgsForCall []struct {
+		arg1 config.Route
+	}
+	unregisterHTTPRouteReturns struct {
+		result1 error
+	}
+	unregisterHTTPRouteReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UnregisterRouteStub        func(config.Route) error
+	unregisterRouteMutex       sync.RWMutex
+	unregisterRouteArgsForCall []struct {
+		arg1 config.Route
+	}
+	unregisterRouteReturns struct {
+		result1 error
+	}
+	unregisterRouteReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeApi) RegisterHTTPRoute(arg1 config.Route) error {
+	fake.registerHTTPRouteMutex.Lock()
+	ret, specificReturn := fake.registerHTTPRouteReturnsOnCall[len(fake.registerHTTPRouteArgsForCall)]
+	fake.registerHTTPRouteArgsForCall = append(fake.registerHTTPRouteArgsForCall, struct {
+		arg1 config.Route
+	}{arg1})
+	stub := fake.RegisterHTTPRouteStub
+	fakeReturns := fake.registerHTTPRouteReturns
+	fake.recordInvocation("RegisterHTTPRoute", []interface{}{arg1})
+	fake.registerHTTPRouteMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeApi) RegisterHTTPRouteCallCount() int {
+	fake.registerHTTPRouteMutex.RLock()
+	defer fake.registerHTTPRouteMutex.RUnlock()
+	return len(fake.registerHTTPRouteArgsForCall)
+}
+
+func (fake *FakeApi) RegisterHTTPRouteCalls(stub func(config.Route) error) {
+	fake.registerHTTPRouteMutex.Lock()
+	defer fake.registerHTTPRouteMutex.Unlock()
+	fake.RegisterHTTPRouteStub = stub
+}
+
+func (fake *FakeApi) RegisterHTTPRouteArgsForCall(i int) config.Route {
+	fake.registerHTTPRouteMutex.RLock()
+	defer fake.registerHTTPRouteMutex.RUnlock()
+	argsForCall := fake.registerHTTPRouteArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeApi) RegisterHTTPRouteReturns(result1 error) {
+	fake.registerHTTPRouteMutex.Lock()
+	defer fake.registerHTTPRouteMutex.Unlock()
+	fake.RegisterHTTPRouteStub = nil
+	fake.registerHTTPRouteReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeApi) RegisterHTTPRouteReturnsOnCall(i int, result1 error) {
+	fake.registerHTTPRouteMutex.Lock()
+	defer fake.registerHTTPRouteMutex.Unlock()
+	fake.RegisterHTTPRouteStub = nil
+	if fake.registerHTTPRouteReturnsOnCall == nil {
+		fake.registerHTTPRouteReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.registerHTTPRouteReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeApi) RegisterRoute(arg1 config.Route) error {
+	fake.registerRouteMutex.Lock()
+	ret, specificReturn := fake.registerRouteReturnsOnCall[len(fake.registerRouteArgsForCall)]
+	fake.registerRouteArgsForCall = append(fake.registerRouteArgsForCall, struct {
+		arg1 config.Route
+	}{arg1})
+	stub := fake.RegisterRouteStub
+	fakeReturns := fake.registerRouteReturns
+	fake.recordInvocation("RegisterRoute", []interface{}{arg1})
+	fake.registerRouteMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeApi) RegisterRouteCallCount() int {
+	fake.registerRouteMutex.RLock()
+	defer fake.registerRouteMutex.RUnlock()
+	return len(fake.registerRouteArgsForCall)
+}
+
+func (fake *FakeApi) RegisterRouteCalls(stub func(config.Route) error) {
+	fake.registerRouteMutex.Lock()
+	defer fake.registerRouteMutex.Unlock()
+	fake.RegisterRouteStub = stub
+}
+
+func (fake *FakeApi) RegisterRouteArgsForCall(i int) config.Route {
+	fake.registerRouteMutex.RLock()
+	defer fake.registerRouteMutex.RUnlock()
+	argsForCall := fake.registerRouteArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeApi) RegisterRouteReturns(result1 error) {
+	fake.registerRouteMutex.Lock()
+	defer fake.registerRouteMutex.Unlock()
+	fake.RegisterRouteStub = nil
+	fake.registerRouteReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeApi) RegisterRouteReturnsOnCall(i int, result1 error) {
+	fake.registerRouteMutex.Lock()
+	defer fake.registerRouteMutex.Unlock()
+	fake.RegisterRouteStub = nil
+	if fake.registerRouteReturnsOnCall == nil {
+		fake.registerRouteReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.registerRouteReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeApi) UnregisterHTTPRoute(arg1 config.Route) error {
+	fake.unregisterHTTPRouteMutex.Lock()
+	ret, specificReturn := fake.unregisterHTTPRouteReturnsOnCall[len(fake.unregisterHTTPRouteArgsForCall)]
+	fake.unregisterHTTPRouteArgsForCall = append(fake.unregisterHTTPRouteArgsForCall, struct {
+		arg1 config.Route
+	}{arg1})
+	stub := fake.UnregisterHTTPRouteStub
+	fakeReturns := fake.unregisterHTTPRouteReturns
+	fake.recordInvocation("UnregisterHTTPRoute", []interface{}{arg1})
+	fake.unregisterHTTPRouteMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeApi) UnregisterHTTPRouteCallCount() int {
+	fake.unregisterHTTPRouteMutex.RLock()
+	defer fake.unregisterHTTPRouteMutex.RUnlock()
+	return len(fake.unregisterHTTPRouteArgsForCall)
+}
+
+func (fake *FakeApi) UnregisterHTTPRouteCalls(stub func(config.Route) error) {
+	fake.unregisterHTTPRouteMutex.Lock()
+	defer fake.unregisterHTTPRouteMutex.Unlock()
+	fake.UnregisterHTTPRouteStub = stub
+}
+
+func (fake *FakeApi) UnregisterHTTPRouteArgsForCall(i int) config.Route {
+	fake.unregisterHTTPRouteMutex.RLock()
+	defer fake.unregisterHTTPRouteMutex.RUnlock()
+	argsForCall := fake.unregisterHTTPRouteArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeApi) UnregisterHTTPRouteReturns(result1 error) {
+	fake.unregisterHTTPRouteMutex.Lock()
+	defer fake.unregisterHTTPRouteMutex.Unlock()
+	fake.UnregisterHTTPRouteStub = nil
+	fake.unregisterHTTPRouteReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeApi) UnregisterHTTPRouteReturnsOnCall(i int, result1 error) {
+	fake.unregisterHTTPRouteMutex.Lock()
+	defer fake.unregisterHTTPRouteMutex.Unlock()
+	fake.UnregisterHTTPRouteStub = nil
+	if fake.unregisterHTTPRouteReturnsOnCall == nil {
+		fake.unregisterHTTPRouteReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.unregisterHTTPRouteReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeApi) UnregisterRoute(arg1 config.Route) error {
+	fake.unregisterRouteMutex.Lock()
+	ret, specificReturn := fake.unregisterRouteReturnsOnCall[len(fake.unregisterRouteArgsForCall)]
+	fake.unregisterRouteArgsForCall = append(fake.unregisterRouteArgsForCall, struct {
+		arg1 config.Route
+	}{arg1})
+	stub := fake.UnregisterRouteStub
+	fakeReturns := fake.unregisterRouteReturns
+	fake.recordInvocation("UnregisterRoute", []interface{}{arg1})
+	fake.unregisterRouteMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeApi) UnregisterRouteCallCount() int {
+	fake.unregisterRouteMutex.RLock()
+	defer fake.unregisterRouteMutex.RUnlock()
+	return len(fake.unregisterRouteArgsForCall)
+}
+
+func (fake *FakeApi) UnregisterRouteCalls(stub func(config.Route) error) {
+	fake.unregisterRouteMutex.Lock()
+	defer fake.unregisterRouteMutex.Unlock()
+	fake.UnregisterRouteStub = stub
+}
+
+func (fake *FakeApi) UnregisterRouteArgsForCall(i int) config.Route {
+	fake.unregisterRouteMutex.RLock()
+	defer fake.unregisterRouteMutex.RUnlock()
+	argsForCall := fake.unregisterRouteArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeApi) UnregisterRouteReturns(result1 error) {
+	fake.unregisterRouteMutex.Lock()
+	defer fake.unregisterRouteMutex.Unlock()
+	fake.UnregisterRouteStub = nil
+	fake.unregisterRouteReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeApi) UnregisterRouteReturnsOnCall(i int, result1 error) {
+	fake.unregisterRouteMutex.Lock()
+	defer fake.unregisterRouteMutex.Unlock()
+	fake.UnregisterRouteStub = nil
+	if fake.unregisterRouteReturnsOnCall == nil {
+		fake.unregisterRouteReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.unregisterRouteReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeApi) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.registerHTTPRouteMutex.RLock()
+	defer fake.registerHTTPRouteMutex.RUnlock()
+	fake.registerRouteMutex.RLock()
+	defer fake.registerRouteMutex.RUnlock()
+	fake.unregisterHTTPRouteMutex.RLock()
+	defer fake.unregisterHTTPRouteMutex.RUnlock()
+	fake.unregisterRouteMutex.RLock()
+	defer fake.unregisterRouteMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeApi) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
@@ -1,34 +1,53 @@
 package registrar
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"time"
 
 	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/multierror"
 	"code.cloudfoundry.org/route-registrar/config"
 	"gopkg.in/yaml.v3"
 )
 
 type RoutesConfigSchema struct {
-	Routes []config.RouteSchema `json:"routes"`
+	RouteDefaults config.RouteDefaultsSchema `json:"route_defaults,omitempty" yaml:"route_defaults,omitempty"`
+	Routes        []config.RouteSchema       `json:"routes"`
 }
 
 type routesConfigWatcher struct {
-	globs               []string
-	host                string
+	config              config.Config
+	claims              *config.RouteClaims
 	logger              lager.Logger
 	watchInterval       time.Duration
 	discoveredRoutes    map[string][]config.Route
 	routeDiscoveredChan chan config.Route
 	routeRemovedChan    chan config.Route
+
+	// errorHandler, when set, is called with every error that keeps routes of
+	// a config file from being registered, in addition to logging it.
+	errorHandler func(configFile string, err error)
 }
 
-func NewRoutesConfigWatcher(logger lager.Logger, watchInterval time.Duration, globs []string, host string, routeDiscoveredChan chan config.Route, routeRemovedChan chan config.Route) *routesConfigWatcher {
+// NewRoutesConfigWatcher returns a watcher for the dynamic config files
+// matching the DynamicConfigGlobs of the config. The other settings for
+// dynamic routes, such as Host and RouteDefaults, are taken from the config
+// as well.
+func NewRoutesConfigWatcher(logger lager.Logger, watchInterval time.Duration, c config.Config, routeDiscoveredChan chan config.Route, routeRemovedChan chan config.Route) *routesConfigWatcher {
+	claims := config.NewRouteClaims()
+	for _, route := range c.Routes {
+		// Conflicts between static routes are rejected when parsing the
+		// config, so this cannot fail.
+		_ = claims.Claim(route, config.MainConfigSource)
+	}
+
 	return &routesConfigWatcher{
-		globs:               globs,
-		host:                host,
+		config:              c,
+		claims:              claims,
 		logger:              logger.Session("routes-config-watcher"),
 		watchInterval:       watchInterval,
 		routeDiscoveredChan: routeDiscoveredChan,
@@ -59,8 +78,9 @@ func (r *routesConfigWatcher) Run(signals <-chan os.Signal, ready chan<- struct{
 
 func (r *routesConfigWatcher) discoverRoutesFromConfigFiles() error {
 	allFiles := map[string]bool{}
+	orderedFiles := []string{}
 
-	for _, glob := range r.globs {
+	for _, glob := range r.config.DynamicConfigGlobs {
 		files, err := filepath.Glob(glob)
 		if err != nil {
 			r.logger.Error("failed-to-glob-config-files", err, lager.Data{"glob": glob})
@@ -69,8 +89,7 @@ func (r *routesConfigWatcher) discoverRoutesFromConfigFiles() error {
 
 		for _, f := range files {
 			allFiles[f] = true
-
-			r.registerNewRoutesFromConfigFile(f)
+			orderedFiles = append(orderedFiles, f)
 		}
 	}
 
@@ -78,57 +97,280 @@ func (r *routesConfigWatcher) discoverRoutesFromConfigFiles() error {
 		if _, ok := allFiles[f]; !ok {
 			r.logger.Info("removing-routes-from-config-file", lager.Data{"file": f})
 			for _, route := range r.discoveredRoutes[f] {
+				r.claims.Release(route, f)
 				r.routeRemovedChan <- route
 			}
 			delete(r.discoveredRoutes, f)
 		}
 	}
 
+	// Routes of removed files are released first, so that routes conflicting
+	// with them are discovered in the same scan.
+	for _, f := range orderedFiles {
+		r.registerNewRoutesFromConfigFile(f)
+	}
+
 	return nil
 }
 
 func (r *routesConfigWatcher) registerNewRoutesFromConfigFile(configFile string) {
-	b, err := os.ReadFile(configFile)
+	configRoutes, err := r.routesFromConfigFile(configFile)
 	if err != nil {
-		r.logger.Error("failed-to-read-macthed-file", err)
 		return
 	}
+	// The previous routes of the file are released first, so that they do not
+	// conflict with their changed versions.
+	for _, route := range r.discoveredRoutes[configFile] {
+		r.claims.Release(route, configFile)
+	}
+	configRoutes = r.claimRoutes(configFile, r.allowedRoutes(configFile, configRoutes))
+
+	if _, ok := r.discoveredRoutes[configFile]; !ok {
+		r.discoveredRoutes[configFile] = []config.Route{}
+	}
+
+	for _, route := range configRoutes {
+		if !containsRoute(r.discoveredRoutes[configFile], route) {
+			r.discoveredRoutes[configFile] = append(r.discoveredRoutes[configFile], route)
+			r.routeDiscoveredChan <- route
+		}
+	}
+
+	for i, route := range r.discoveredRoutes[configFile] {
+		if !containsRoute(configRoutes, route) {
+			r.discoveredRoutes[configFile] = append(r.discoveredRoutes[configFile][:i], r.discoveredRoutes[configFile][i+1:]...)
+			r.claims.Release(route, configFile)
+			r.routeRemovedChan <- route
+		}
+	}
+}
+
+// allowedRoutes returns the routes of the config file that are allowed by at
+// least one of the policies matching the file. Once policies are configured,
+// files not matched by any policy may not register routes at all.
+func (r *routesConfigWatcher) allowedRoutes(configFile string, routes []config.Route) []config.Route {
+	if len(r.config.DynamicConfigPolicies) == 0 {
+		return routes
+	}
+
+	policies := r.policiesFor(configFile)
+	allowed := []config.Route{}
+	for _, route := range routes {
+		violations := multierror.NewMultiError(configFile)
+		if len(policies) == 0 {
+			violations.Add(errors.New("no dynamic_config_policies apply to the file"))
+		}
+		for _, policy := range policies {
+			err := policy.Allows(route)
+			if err == nil {
+				violations = nil
+				break
+			}
+			violations.Add(err)
+		}
+
+		if violations != nil {
+			r.reportError("route-not-allowed-by-policy", configFile, violations, lager.Data{"route": route})
+			continue
+		}
+		allowed = append(allowed, route)
+	}
+	return allowed
+}
+
+func (r *routesConfigWatcher) policiesFor(configFile string) []config.DynamicConfigPolicy {
+	var ownerUID *uint32
+	info, err := os.Stat(configFile)
+	if err == nil {
+		if uid, ok := fileOwnerUID(info); ok {
+			ownerUID = &uid
+		}
+	}
+
+	policies := []config.DynamicConfigPolicy{}
+	for _, policy := range r.config.DynamicConfigPolicies {
+		if policy.Glob != "" {
+			// The glob is validated when parsing the config.
+			matched, _ := filepath.Match(policy.Glob, configFile)
+			if !matched {
+				continue
+			}
+		}
+		if policy.OwnerUID != nil && (ownerUID == nil || *ownerUID != *policy.OwnerUID) {
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+// claimRoutes returns the routes of the config file that do not conflict with
+// static routes or routes of other config files. Conflicting routes are
+// logged and skipped until the routes they conflict with are removed.
+func (r *routesConfigWatcher) claimRoutes(configFile string, routes []config.Route) []config.Route {
+	claimed := []config.Route{}
+	for _, route := range routes {
+		err := r.claims.Claim(route, configFile)
+		if err != nil {
+			r.reportError("route-conflict", configFile, err, lager.Data{"route": route})
+			continue
+		}
+		claimed = append(claimed, route)
+	}
+	return claimed
+}
+
+// routesFromConfigFile returns the valid routes in the config file. Invalid
+// routes are logged and skipped.
+func (r *routesConfigWatcher) routesFromConfigFile(configFile string) ([]config.Route, error) {
+	b, err := os.ReadFile(configFile)
+	if err != nil {
+		r.reportError("failed-to-read-macthed-file", configFile, err)
+		return nil, err
+	}
 	var routesConfig RoutesConfigSchema
 	err = yaml.Unmarshal(b, &routesConfig)
 	if err != nil {
-		r.logger.Error("failed-to-parse-file", err)
-		return
+		r.reportError("failed-to-parse-file", configFile, err)
+		return nil, err
 	}
 
-	if _, ok := r.discoveredRoutes[configFile]; !ok {
-		r.discoveredRoutes[configFile] = []config.Route{}
+	unknownRouteFields := map[int][]error{}
+	if r.config.StrictConfig {
+		unknownFields, err := config.UnknownFields(b, RoutesConfigSchema{})
+		if err != nil {
+			r.reportError("failed-to-parse-file", configFile, err)
+			return nil, err
+		}
+
+		fileErrors := multierror.NewMultiError(configFile)
+		for _, unknownField := range unknownFields {
+			if unknownField.RouteIndex < 0 {
+				fileErrors.Add(unknownField)
+				continue
+			}
+			unknownRouteFields[unknownField.RouteIndex] = append(unknownRouteFields[unknownField.RouteIndex], unknownField)
+		}
+		if fileErrors.Length() > 0 {
+			r.reportError("failed-to-parse-file", configFile, fileErrors)
+			return nil, fileErrors
+		}
 	}
 
-	configRoutes := []config.Route{}
+	templateData, err := config.NewTemplateData(r.config)
+	if err != nil {
+		r.reportError("failed-to-parse-file", configFile, err)
+		return nil, err
+	}
 
+	configRoutes := []config.Route{}
 	for i, routeSchema := range routesConfig.Routes {
-		route, err := config.RouteFromSchema(routeSchema, i, r.host)
+		if errs, ok := unknownRouteFields[i]; ok {
+			routeErrors := multierror.NewMultiError(configFile)
+			for _, err := range errs {
+				routeErrors.Add(err)
+			}
+			r.reportError("failed-to-parse-route", configFile, routeErrors)
+			continue
+		}
+
+		schema, err := routeSchema.WithDefaults(routesConfig.RouteDefaults, r.config.RouteDefaults).ExpandTemplates(templateData, i)
 		if err != nil {
-			r.logger.Error("failed-to-parse-route", err)
+			r.reportError("failed-to-parse-route", configFile, err)
 			continue
 		}
 
-		if route != nil {
-			configRoutes = append(configRoutes, *route)
+		routes, err := config.RoutesFromSchema(schema, i, r.config.Host, r.config.RouteParseOptions())
+		if err != nil {
+			r.reportError("failed-to-parse-route", configFile, err)
+			continue
+		}
 
-			if !containsRoute(r.discoveredRoutes[configFile], *route) {
-				r.discoveredRoutes[configFile] = append(r.discoveredRoutes[configFile], *route)
-				r.routeDiscoveredChan <- *route
-			}
+		err = r.validateTransport(configFile, routes)
+		if err != nil {
+			r.reportError("failed-to-parse-route", configFile, err)
+			continue
 		}
+
+		configRoutes = append(configRoutes, routes...)
 	}
 
-	for i, route := range r.discoveredRoutes[configFile] {
-		if !containsRoute(configRoutes, route) {
-			r.discoveredRoutes[configFile] = append(r.discoveredRoutes[configFile][:i], r.discoveredRoutes[configFile][i+1:]...)
-			r.routeRemovedChan <- route
+	return configRoutes, nil
+}
+
+// validateTransport checks that the routes can be registered with their
+// transport, which the main config could not check for dynamic routes.
+func (r *routesConfigWatcher) validateTransport(configFile string, routes []config.Route) error {
+	for _, route := range routes {
+		err := route.ValidateTransport(r.config.Transport, r.config.RoutingAPI.APIURL != "")
+		if err != nil {
+			routeErrors := multierror.NewMultiError(fmt.Sprintf("%s: route %q", configFile, route.Name))
+			routeErrors.Add(err)
+			return routeErrors
+		}
+	}
+	return nil
+}
+
+// DynamicRoutes returns the routes currently defined in the files matching
+// the DynamicConfigGlobs of the config, as the routes config watcher would
+// discover them.
+func DynamicRoutes(logger lager.Logger, c config.Config) ([]config.Route, error) {
+	return NewRoutesConfigWatcher(logger, 0, c, nil, nil).currentRoutes()
+}
+
+// ValidateDynamicRoutes is like DynamicRoutes, but also returns the errors
+// that keep routes from being registered, by config file: files that cannot
+// be parsed, invalid routes, routes not allowed by the
+// DynamicConfigPolicies and routes conflicting with other routes.
+func ValidateDynamicRoutes(logger lager.Logger, c config.Config) ([]config.Route, map[string][]error, error) {
+	fileErrors := map[string][]error{}
+
+	watcher := NewRoutesConfigWatcher(logger, 0, c, nil, nil)
+	watcher.errorHandler = func(configFile string, err error) {
+		fileErrors[configFile] = append(fileErrors[configFile], err)
+	}
+
+	routes, err := watcher.currentRoutes()
+	if err != nil {
+		return nil, nil, err
+	}
+	return routes, fileErrors, nil
+}
+
+func (r *routesConfigWatcher) currentRoutes() ([]config.Route, error) {
+	routes := []config.Route{}
+	seenFiles := map[string]bool{}
+	for _, glob := range r.config.DynamicConfigGlobs {
+		files, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			if seenFiles[f] {
+				continue
+			}
+			seenFiles[f] = true
+
+			fileRoutes, err := r.routesFromConfigFile(f)
+			if err != nil {
+				continue
+			}
+			routes = append(routes, r.claimRoutes(f, r.allowedRoutes(f, fileRoutes))...)
 		}
 	}
+
+	return routes, nil
+}
+
+// reportError logs an error that keeps routes of the config file from being
+// registered and passes it to the error handler, if any.
+func (r *routesConfigWatcher) reportError(action string, configFile string, err error, data ...lager.Data) {
+	r.logger.Error(action, err, append([]lager.Data{{"file": configFile}}, data...)...)
+	if r.errorHandler != nil {
+		r.errorHandler(configFile, err)
+	}
 }
 
 func containsRoute(routes []config.Route, route config.Route) bool {
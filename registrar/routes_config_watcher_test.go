@@ -43,7 +43,8 @@ var _ = Describe("RoutesConfigWatcher", func() {
 		routesDiscovered = make(chan config.Route)
 		routesRemoved = make(chan config.Route)
 
-		routesConfigWatcher = registrar.NewRoutesConfigWatcher(logger, time.Second, []string{glob}, host, routesDiscovered, routesRemoved)
+		routingAPI := config.RoutingAPI{APIURL: "http://routing-api.example.com"}
+		routesConfigWatcher = registrar.NewRoutesConfigWatcher(logger, time.Second, config.Config{DynamicConfigGlobs: []string{glob}, Host: host, RoutingAPI: routingAPI}, routesDiscovered, routesRemoved)
 
 		port := uint16(8080)
 		route1 = config.Route{
@@ -253,6 +254,47 @@ var _ = Describe("RoutesConfigWatcher", func() {
 				})
 			})
 
+			Context("when the port of a route with an external port is changed", func() {
+				It("replaces the route instead of reporting a conflict with itself", func() {
+					var receivedRoute config.Route
+					Eventually(routesDiscovered, 2).Should(Receive(&receivedRoute))
+					Eventually(routesDiscovered, 2).Should(Receive(&receivedRoute))
+					Eventually(routesDiscovered, 2).Should(Receive(&receivedRoute))
+
+					externalPort := uint16(61000)
+					otherPort := uint16(9090)
+					tcpSchema := route1Schema
+					tcpSchema.ExternalPort = &externalPort
+					changedSchema := tcpSchema
+					changedSchema.Port = &otherPort
+
+					writeFile1 := func(schema config.RouteSchema) {
+						routesBytes1, err := yaml.Marshal(registrar.RoutesConfigSchema{Routes: []config.RouteSchema{schema}})
+						Expect(err).NotTo(HaveOccurred())
+						Expect(cfgFile1.Truncate(0)).To(Succeed())
+						_, err = cfgFile1.Seek(0, 0)
+						Expect(err).NotTo(HaveOccurred())
+						_, err = cfgFile1.Write(routesBytes1)
+						Expect(err).NotTo(HaveOccurred())
+					}
+
+					writeFile1(tcpSchema)
+					Eventually(routesDiscovered, 2).Should(Receive(&receivedRoute))
+					Expect(*receivedRoute.ExternalPort).To(Equal(externalPort))
+					Eventually(routesRemoved, 2).Should(Receive(&receivedRoute))
+					Expect(receivedRoute).To(Equal(route1))
+					Eventually(routesRemoved, 2).Should(Receive(&receivedRoute))
+					Expect(receivedRoute).To(Equal(route2))
+
+					writeFile1(changedSchema)
+					Eventually(routesDiscovered, 2).Should(Receive(&receivedRoute))
+					Expect(*receivedRoute.Port).To(Equal(otherPort))
+					Eventually(routesRemoved, 2).Should(Receive(&receivedRoute))
+					Expect(*receivedRoute.Port).To(Equal(uint16(8080)))
+					Expect(logger).NotTo(gbytes.Say("route-conflict"))
+				})
+			})
+
 			Context("when config file is removed", func() {
 				It("removes routes from that config file", func() {
 					var receivedRoute config.Route
@@ -275,6 +317,46 @@ var _ = Describe("RoutesConfigWatcher", func() {
 			})
 		})
 
+		Context("when a route conflicts with a route of another config file", func() {
+			var conflictingRoute config.Route
+
+			BeforeEach(func() {
+				otherPort := uint16(9090)
+				conflictingSchema := route3Schema
+				conflictingSchema.Name = "steals-some-route-3"
+				conflictingSchema.Port = &otherPort
+				conflictingRoute = route3
+				conflictingRoute.Name = "steals-some-route-3"
+				conflictingRoute.Port = &otherPort
+
+				routesBytes1, err := yaml.Marshal(registrar.RoutesConfigSchema{Routes: []config.RouteSchema{route3Schema}})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = cfgFile1.Write(routesBytes1)
+				Expect(err).NotTo(HaveOccurred())
+
+				routesBytes2, err := yaml.Marshal(registrar.RoutesConfigSchema{Routes: []config.RouteSchema{conflictingSchema}})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = cfgFile2.Write(routesBytes2)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("does not discover the later route until the earlier one is removed", func() {
+				var receivedRoute config.Route
+				Eventually(routesDiscovered, 2).Should(Receive(&receivedRoute))
+				Expect(receivedRoute).To(Equal(route3))
+				Eventually(logger, 2).Should(gbytes.Say("route-conflict"))
+				Consistently(routesDiscovered).ShouldNot(Receive())
+
+				err := os.Remove(cfgFile1.Name())
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(routesRemoved, 2).Should(Receive(&receivedRoute))
+				Expect(receivedRoute).To(Equal(route3))
+				Eventually(routesDiscovered, 2).Should(Receive(&receivedRoute))
+				Expect(receivedRoute).To(Equal(conflictingRoute))
+			})
+		})
+
 		Context("when config file is in wrong format", func() {
 			BeforeEach(func() {
 				_, err := cfgFile1.Write([]byte(`invalid`))
@@ -286,9 +368,37 @@ var _ = Describe("RoutesConfigWatcher", func() {
 			})
 		})
 
+		Context("when a route has options unknown to route-registrar", func() {
+			BeforeEach(func() {
+				route3Schema.Options = &config.Options{Unknown: map[string]string{"some_new_option": "some-value"}}
+				routesBytes1, err := yaml.Marshal(registrar.RoutesConfigSchema{Routes: []config.RouteSchema{route3Schema}})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = cfgFile1.Write(routesBytes1)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("logs an error and does not discover the route", func() {
+				Eventually(logger, 2).Should(gbytes.Say("failed-to-parse-route"))
+				Eventually(logger).Should(gbytes.Say("unknown options: some_new_option"))
+				Consistently(routesDiscovered).ShouldNot(Receive())
+			})
+
+			Context("when unknown route options are allowed", func() {
+				BeforeEach(func() {
+					routesConfigWatcher = registrar.NewRoutesConfigWatcher(logger, time.Second, config.Config{DynamicConfigGlobs: []string{glob}, Host: host, AllowUnknownRouteOptions: true}, routesDiscovered, routesRemoved)
+				})
+
+				It("discovers the route with the options", func() {
+					var receivedRoute config.Route
+					Eventually(routesDiscovered, 2).Should(Receive(&receivedRoute))
+					Expect(receivedRoute.Options.Unknown).To(Equal(map[string]string{"some_new_option": "some-value"}))
+				})
+			})
+		})
+
 		Context("when host is not set globally and in config file", func() {
 			BeforeEach(func() {
-				routesConfigWatcher = registrar.NewRoutesConfigWatcher(logger, time.Second, []string{glob}, "", routesDiscovered, routesRemoved)
+				routesConfigWatcher = registrar.NewRoutesConfigWatcher(logger, time.Second, config.Config{DynamicConfigGlobs: []string{glob}}, routesDiscovered, routesRemoved)
 				port := uint16(8080)
 				routesBytes1, err := yaml.Marshal(registrar.RoutesConfigSchema{Routes: []config.RouteSchema{
 					{
@@ -312,3 +422,476 @@ var _ = Describe("RoutesConfigWatcher", func() {
 		})
 	})
 })
+
+var _ = Describe("DynamicRoutes", func() {
+	var (
+		logger *lagertest.TestLogger
+		cfgDir string
+		glob   string
+		port   uint16
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("dynamic routes test")
+		var err error
+		cfgDir, err = os.MkdirTemp(os.TempDir(), "config-")
+		Expect(err).NotTo(HaveOccurred())
+		glob = fmt.Sprintf("%s/config-*.yml", cfgDir)
+		port = 8080
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(cfgDir)
+	})
+
+	writeRoutes := func(name string, routes ...config.RouteSchema) {
+		routesBytes, err := yaml.Marshal(registrar.RoutesConfigSchema{Routes: routes})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(fmt.Sprintf("%s/%s", cfgDir, name), routesBytes, 0644)).To(Succeed())
+	}
+
+	It("returns the valid routes of all matching files", func() {
+		writeRoutes("config-1.yml", config.RouteSchema{
+			Name:                 "route-1",
+			Port:                 &port,
+			RegistrationInterval: "1s",
+			URIs:                 []string{"route-1.apps.com"},
+		})
+		writeRoutes("config-2.yml", config.RouteSchema{
+			Name:                 "route-2",
+			Port:                 &port,
+			RegistrationInterval: "1s",
+			URIs:                 []string{"route-2.apps.com"},
+		}, config.RouteSchema{
+			Name: "invalid-route",
+		})
+		writeRoutes("other.yml", config.RouteSchema{
+			Name:                 "not-matching",
+			Port:                 &port,
+			RegistrationInterval: "1s",
+			URIs:                 []string{"not-matching.apps.com"},
+		})
+
+		routes, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob}, Host: "127.0.0.1"})
+		Expect(err).NotTo(HaveOccurred())
+
+		names := []string{}
+		for _, route := range routes {
+			names = append(names, route.Name)
+			Expect(route.Host).To(Equal("127.0.0.1"))
+		}
+		Expect(names).To(ConsistOf("route-1", "route-2"))
+		Expect(logger).To(gbytes.Say("failed-to-parse-route"))
+	})
+
+	It("returns an error for an invalid glob", func() {
+		_, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{"["}, Host: "127.0.0.1"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when the routes are registered with the routing API", func() {
+		var externalPort uint16
+
+		BeforeEach(func() {
+			externalPort = 61000
+			writeRoutes("config-1.yml", config.RouteSchema{
+				Name:                 "http-route",
+				RegistrationInterval: "1s",
+				URIs:                 []string{"http-route.apps.com"},
+				TLSPort:              &port,
+				ServerCertDomainSAN:  "http-route.internal",
+			}, config.RouteSchema{
+				Name:                 "tcp-route",
+				Type:                 "tcp",
+				Port:                 &port,
+				ExternalPort:         &externalPort,
+				RouterGroup:          "default-tcp",
+				RegistrationInterval: "1s",
+			})
+		})
+
+		It("skips routes when the routing API is not configured", func() {
+			routes, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob}, Host: "127.0.0.1", Transport: config.TransportRoutingAPI})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(BeEmpty())
+			Expect(logger).To(gbytes.Say("failed-to-parse-route"))
+			Expect(logger).To(gbytes.Say("transport routing_api requires routing_api to be configured"))
+		})
+
+		It("skips HTTP routes without a port", func() {
+			c := config.Config{
+				DynamicConfigGlobs: []string{glob},
+				Host:               "127.0.0.1",
+				Transport:          config.TransportRoutingAPI,
+				RoutingAPI:         config.RoutingAPI{APIURL: "http://routing-api.example.com"},
+			}
+			routes, err := registrar.DynamicRoutes(logger, c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Name).To(Equal("tcp-route"))
+			Expect(logger).To(gbytes.Say("transport routing_api requires port"))
+		})
+	})
+
+	Context("when route defaults are set", func() {
+		It("merges the file defaults and then the global defaults under each route", func() {
+			Expect(os.WriteFile(fmt.Sprintf("%s/config-1.yml", cfgDir), []byte(`
+route_defaults:
+  registration_interval: 5s
+  tags:
+    team: routing
+    component: from-file
+routes:
+- name: route-1
+  port: 8080
+  uris: [route-1.apps.com]
+  tags:
+    component: route-1
+- name: route-2
+  port: 8080
+  uris: [route-2.apps.com]
+  registration_interval: 1s
+`), 0644)).To(Succeed())
+
+			globalDefaults := config.RouteDefaultsSchema{
+				RegistrationInterval: "20s",
+				Tags:                 map[string]string{"env": "prod", "team": "global"},
+			}
+			routes, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob}, Host: "127.0.0.1", StrictConfig: true, RouteDefaults: globalDefaults})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(2))
+
+			Expect(routes[0].RegistrationInterval).To(Equal(5 * time.Second))
+			Expect(routes[0].Tags).To(Equal(map[string]string{"env": "prod", "team": "routing", "component": "route-1"}))
+			Expect(routes[1].RegistrationInterval).To(Equal(time.Second))
+			Expect(routes[1].Tags).To(Equal(map[string]string{"env": "prod", "team": "routing", "component": "from-file"}))
+		})
+	})
+
+	It("expands templates in the routes", func() {
+		Expect(os.WriteFile(fmt.Sprintf("%s/config-1.yml", cfgDir), []byte(`
+routes:
+- name: route-{{.AvailabilityZone}}
+  port: 8080
+  uris: [route-1.apps.com]
+  registration_interval: 1s
+  tags:
+    az: "{{.AvailabilityZone}}"
+`), 0644)).To(Succeed())
+
+		routes, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob}, Host: "127.0.0.1", AvailabilityZone: "z1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(routes).To(HaveLen(1))
+		Expect(routes[0].Name).To(Equal("route-z1"))
+		Expect(routes[0].Tags).To(Equal(map[string]string{"az": "z1"}))
+	})
+
+	Context("when routes conflict", func() {
+		var staticRoutes []config.Route
+
+		BeforeEach(func() {
+			staticRoutes = []config.Route{{
+				Name: "static-route",
+				Host: "127.0.0.1",
+				Port: &port,
+				URIs: []string{"static.apps.com"},
+			}}
+		})
+
+		It("skips routes conflicting with static routes or routes of earlier files", func() {
+			otherPort := uint16(9090)
+			writeRoutes("config-1.yml", config.RouteSchema{
+				Name:                 "route-1",
+				Port:                 &port,
+				RegistrationInterval: "1s",
+				URIs:                 []string{"route-1.apps.com"},
+			}, config.RouteSchema{
+				Name:                 "steals-static",
+				Port:                 &otherPort,
+				RegistrationInterval: "1s",
+				URIs:                 []string{"static.apps.com"},
+			})
+			writeRoutes("config-2.yml", config.RouteSchema{
+				Name:                 "steals-route-1",
+				Port:                 &otherPort,
+				RegistrationInterval: "1s",
+				URIs:                 []string{"route-1.apps.com"},
+			}, config.RouteSchema{
+				Name:                 "route-2",
+				Port:                 &otherPort,
+				RegistrationInterval: "1s",
+				URIs:                 []string{"route-2.apps.com"},
+			})
+
+			routes, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob}, Host: "127.0.0.1", Routes: staticRoutes})
+			Expect(err).NotTo(HaveOccurred())
+
+			names := []string{}
+			for _, route := range routes {
+				names = append(names, route.Name)
+			}
+			Expect(names).To(ConsistOf("route-1", "route-2"))
+			Expect(logger).To(gbytes.Say("route-conflict"))
+			Expect(logger).To(gbytes.Say(`route \\"steals-static\\" in .*config-1.yml conflicts with route \\"static-route\\" in the main config: both claim URI \\"static.apps.com\\"`))
+			Expect(logger).To(gbytes.Say("route-conflict"))
+			Expect(logger).To(gbytes.Say(`route \\"steals-route-1\\" in .*config-2.yml conflicts with route \\"route-1\\" in .*config-1.yml`))
+		})
+
+		It("skips tcp routes claiming an external port of an earlier route of the same file", func() {
+			externalPort := uint16(61000)
+			otherPort := uint16(9090)
+			writeRoutes("config-1.yml", config.RouteSchema{
+				Name:                 "tcp-route",
+				Type:                 "tcp",
+				Port:                 &port,
+				ExternalPort:         &externalPort,
+				RouterGroup:          "default-tcp",
+				RegistrationInterval: "1s",
+			}, config.RouteSchema{
+				Name:                 "same-external-port",
+				Type:                 "tcp",
+				Port:                 &otherPort,
+				ExternalPort:         &externalPort,
+				RouterGroup:          "default-tcp",
+				RegistrationInterval: "1s",
+			})
+
+			routes, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob}, Host: "127.0.0.1", RoutingAPI: config.RoutingAPI{APIURL: "http://routing-api.example.com"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Name).To(Equal("tcp-route"))
+			Expect(logger).To(gbytes.Say(`route \\"same-external-port\\" in .*config-1.yml conflicts with route \\"tcp-route\\" in .*config-1.yml: both claim external_port 61000`))
+		})
+	})
+
+	Context("when policies are configured", func() {
+		var c config.Config
+
+		BeforeEach(func() {
+			otherPort := uint16(9090)
+			writeRoutes("config-team-a.yml", config.RouteSchema{
+				Name:                 "team-a",
+				Port:                 &port,
+				RegistrationInterval: "1s",
+				URIs:                 []string{"app.team-a.apps.com"},
+			}, config.RouteSchema{
+				Name:                 "team-a-steals",
+				Port:                 &port,
+				RegistrationInterval: "1s",
+				URIs:                 []string{"app.team-b.apps.com"},
+			})
+			writeRoutes("config-other.yml", config.RouteSchema{
+				Name:                 "other",
+				Port:                 &otherPort,
+				RegistrationInterval: "1s",
+				URIs:                 []string{"other.team-b.apps.com"},
+			})
+
+			c = config.Config{
+				DynamicConfigGlobs: []string{glob},
+				Host:               "127.0.0.1",
+				DynamicConfigPolicies: []config.DynamicConfigPolicy{{
+					Glob:    fmt.Sprintf("%s/config-team-a.yml", cfgDir),
+					Domains: []string{"team-a.apps.com"},
+				}},
+			}
+		})
+
+		It("skips routes not allowed by the policies of their file", func() {
+			routes, err := registrar.DynamicRoutes(logger, c)
+			Expect(err).NotTo(HaveOccurred())
+
+			names := []string{}
+			for _, route := range routes {
+				names = append(names, route.Name)
+			}
+			Expect(names).To(ConsistOf("team-a"))
+			Expect(logger).To(gbytes.Say("route-not-allowed-by-policy"))
+			Expect(logger).To(gbytes.Say(`URI \\"app.team-b.apps.com\\" is not in an allowed domain`))
+		})
+
+		It("skips all routes of files no policy applies to", func() {
+			_, err := registrar.DynamicRoutes(logger, c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logger).To(gbytes.Say(`route-not-allowed-by-policy.*config-other.yml.*no dynamic_config_policies apply to the file`))
+		})
+
+		It("matches policies by the owner of the file", func() {
+			uid := uint32(os.Getuid())
+			c.DynamicConfigPolicies = []config.DynamicConfigPolicy{{
+				OwnerUID: &uid,
+				Domains:  []string{"team-a.apps.com"},
+			}}
+
+			routes, err := registrar.DynamicRoutes(logger, c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Name).To(Equal("team-a"))
+		})
+
+		It("allows routes allowed by any matching policy", func() {
+			c.DynamicConfigPolicies = append(c.DynamicConfigPolicies, config.DynamicConfigPolicy{
+				Glob:    fmt.Sprintf("%s/config-*.yml", cfgDir),
+				Domains: []string{"team-b.apps.com"},
+			})
+
+			routes, err := registrar.DynamicRoutes(logger, c)
+			Expect(err).NotTo(HaveOccurred())
+
+			names := []string{}
+			for _, route := range routes {
+				names = append(names, route.Name)
+			}
+			Expect(names).To(ConsistOf("team-a", "team-a-steals", "other"))
+		})
+	})
+
+	Context("when strict", func() {
+		writeFile := func(name, contents string) {
+			Expect(os.WriteFile(fmt.Sprintf("%s/%s", cfgDir, name), []byte(contents), 0644)).To(Succeed())
+		}
+
+		It("skips routes with unknown fields and reports them", func() {
+			writeFile("config-1.yml", `
+routes:
+- name: route-1
+  port: 8080
+  uris: [route-1.apps.com]
+  registration_interval: 1s
+- name: typo-route
+  port: 8080
+  uris: [typo-route.apps.com]
+  registraton_interval: 1s
+`)
+
+			routes, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob}, Host: "127.0.0.1", StrictConfig: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Name).To(Equal("route-1"))
+			Expect(logger).To(gbytes.Say("failed-to-parse-route"))
+			Expect(logger).To(gbytes.Say(`config-1.yml`))
+			Expect(logger).To(gbytes.Say(`unknown field \\"registraton_interval\\" in routes\[1\] \(route \\"typo-route\\"\), did you mean \\"registration_interval\\"\?`))
+		})
+
+		It("skips files with unknown top-level fields", func() {
+			writeFile("config-1.yml", `
+rotues:
+- name: route-1
+`)
+
+			routes, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob}, Host: "127.0.0.1", StrictConfig: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(BeEmpty())
+			Expect(logger).To(gbytes.Say("failed-to-parse-file"))
+			Expect(logger).To(gbytes.Say(`did you mean \\"routes\\"\?`))
+		})
+
+		It("ignores unknown fields when not strict", func() {
+			writeFile("config-1.yml", `
+routes:
+- name: route-1
+  port: 8080
+  uris: [route-1.apps.com]
+  registration_interval: 1s
+  colour: blue
+`)
+
+			routes, err := registrar.DynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob}, Host: "127.0.0.1"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+		})
+	})
+})
+
+var _ = Describe("ValidateDynamicRoutes", func() {
+	var (
+		logger *lagertest.TestLogger
+		cfgDir string
+		glob   string
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("validate dynamic routes test")
+		var err error
+		cfgDir, err = os.MkdirTemp(os.TempDir(), "config-")
+		Expect(err).NotTo(HaveOccurred())
+		glob = fmt.Sprintf("%s/config-*.yml", cfgDir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(cfgDir)
+	})
+
+	writeFile := func(name, contents string) string {
+		path := fmt.Sprintf("%s/%s", cfgDir, name)
+		Expect(os.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		return path
+	}
+
+	It("returns the errors of each file", func() {
+		validFile := writeFile("config-1.yml", `
+routes:
+- name: route-1
+  port: 8080
+  uris: [route-1.apps.com]
+  registration_interval: 1s
+`)
+		invalidFile := writeFile("config-2.yml", `
+routes:
+- name: route-2
+  port: 8080
+  uris: [route-2.apps.com]
+  registration_interval: 1s
+- name: invalid-route
+- name: conflicting-route
+  port: 8081
+  uris: [route-1.apps.com]
+  registration_interval: 1s
+`)
+		unparsableFile := writeFile("config-3.yml", "routes: {")
+
+		routes, fileErrors, err := registrar.ValidateDynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{glob, glob}, Host: "127.0.0.1"})
+		Expect(err).NotTo(HaveOccurred())
+
+		names := []string{}
+		for _, route := range routes {
+			names = append(names, route.Name)
+		}
+		Expect(names).To(ConsistOf("route-1", "route-2"))
+
+		Expect(fileErrors).NotTo(HaveKey(validFile))
+		Expect(fileErrors[invalidFile]).To(HaveLen(2))
+		Expect(fileErrors[invalidFile][0]).To(MatchError(ContainSubstring(`route "invalid-route"`)))
+		Expect(fileErrors[invalidFile][1]).To(MatchError(ContainSubstring(`route "conflicting-route" in %s conflicts with route "route-1" in %s`, invalidFile, validFile)))
+		Expect(fileErrors[unparsableFile]).To(HaveLen(1))
+	})
+
+	It("returns the routes not allowed by policies", func() {
+		writeFile("config-1.yml", `
+routes:
+- name: route-1
+  port: 8080
+  uris: [route-1.apps.com]
+  registration_interval: 1s
+`)
+
+		c := config.Config{
+			DynamicConfigGlobs:    []string{glob},
+			Host:                  "127.0.0.1",
+			DynamicConfigPolicies: []config.DynamicConfigPolicy{{Glob: glob, Domains: []string{"other.com"}}},
+		}
+		routes, fileErrors, err := registrar.ValidateDynamicRoutes(logger, c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(routes).To(BeEmpty())
+		Expect(fileErrors).To(HaveLen(1))
+		for _, errs := range fileErrors {
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0]).To(MatchError(ContainSubstring(`URI "route-1.apps.com" is not in an allowed domain`)))
+		}
+	})
+
+	It("returns an error for an invalid glob", func() {
+		_, _, err := registrar.ValidateDynamicRoutes(logger, config.Config{DynamicConfigGlobs: []string{"["}, Host: "127.0.0.1"})
+		Expect(err).To(HaveOccurred())
+	})
+})
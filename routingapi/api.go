@@ -2,7 +2,10 @@ package routingapi
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/route-registrar/config"
@@ -10,17 +13,42 @@ import (
 
 	"code.cloudfoundry.org/routing-api/models"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/multierror"
 	routing_api "code.cloudfoundry.org/routing-api"
 )
 
+const (
+	// tokenExpiryBuffer is how long before its expiry a cached token is
+	// replaced.
+	tokenExpiryBuffer = 30 * time.Second
+	// tokenRetryInterval is how long to wait before trying to refresh the
+	// token again after a failure.
+	tokenRetryInterval = 5 * time.Second
+	// routerGroupCacheTTL is how long a router group is used before it is
+	// looked up again, in case it has been recreated with a new GUID.
+	routerGroupCacheTTL = 5 * time.Minute
+)
+
 type RoutingAPI struct {
-	logger          lager.Logger
-	uaaClient       uaaClient
-	apiClient       routing_api.Client
-	routerGroupGUID map[string]string
+	logger    lager.Logger
+	clock     clock.Clock
+	uaaClient uaaClient
+
+	apiClientLock sync.RWMutex
+	apiClient     routing_api.Client
+
+	routerGroupLock sync.Mutex
+	routerGroups    map[string]cachedRouterGroup
+
+	ownedRoutesLock sync.Mutex
+	ownedRoutes     map[string]ownedRoute
 
 	routingAPIMaxTTL time.Duration
+
+	tokenLock sync.Mutex
+	token     *oauth2.Token
 }
 
 //go:generate counterfeiter . uaaClient
@@ -28,73 +56,344 @@ type uaaClient interface {
 	FetchToken(context.Context, bool) (*oauth2.Token, error)
 }
 
-func NewRoutingAPI(logger lager.Logger, uaaClient uaaClient, apiClient routing_api.Client, routingAPIMaxTTL time.Duration) *RoutingAPI {
+func NewRoutingAPI(logger lager.Logger, clock clock.Clock, uaaClient uaaClient, apiClient routing_api.Client, routingAPIMaxTTL time.Duration) *RoutingAPI {
 	return &RoutingAPI{
-		uaaClient:       uaaClient,
-		apiClient:       apiClient,
-		logger:          logger,
-		routerGroupGUID: make(map[string]string),
+		clock:        clock,
+		uaaClient:    uaaClient,
+		apiClient:    apiClient,
+		logger:       logger,
+		routerGroups: make(map[string]cachedRouterGroup),
+		ownedRoutes:  make(map[string]ownedRoute),
 
 		routingAPIMaxTTL: routingAPIMaxTTL,
 	}
 }
 
+// Run keeps the UAA token fresh in the background, so that registering a
+// route does not have to wait for a new token.
+func (r *RoutingAPI) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+
+	wait := time.Duration(0)
+	for {
+		timer := r.clock.NewTimer(wait)
+		select {
+		case <-timer.C():
+			err := r.refreshToken()
+			if err != nil {
+				wait = tokenRetryInterval
+			} else {
+				wait = r.untilTokenRefresh()
+			}
+		case <-signals:
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+// refreshToken fetches a new token unless the cached one is valid for longer
+// than tokenExpiryBuffer.
 func (r *RoutingAPI) refreshToken() error {
+	r.tokenLock.Lock()
+	defer r.tokenLock.Unlock()
+
+	if r.tokenValid() {
+		return nil
+	}
+	return r.fetchToken()
+}
+
+// forceRefreshToken fetches a new token even if the cached one has not
+// expired, e.g. because the routing API rejected it.
+func (r *RoutingAPI) forceRefreshToken() error {
+	r.tokenLock.Lock()
+	defer r.tokenLock.Unlock()
+
+	return r.fetchToken()
+}
+
+func (r *RoutingAPI) fetchToken() error {
 	r.logger.Info("refresh-token")
-	token, err := r.uaaClient.FetchToken(context.Background(), false)
+	token, err := r.uaaClient.FetchToken(context.Background(), true)
 	if err != nil {
 		r.logger.Error("token-error", err)
 		return err
 	}
 
-	r.logger.Debug("set-token", lager.Data{"token": token})
-	r.apiClient.SetToken(token.AccessToken)
+	r.logger.Debug("set-token", lager.Data{"expiry": token.Expiry})
+	r.client().SetToken(token.AccessToken)
+	r.token = token
 	return nil
 }
 
-func (r *RoutingAPI) getRouterGroupGUID(name string) (string, error) {
-	guid, exists := r.routerGroupGUID[name]
-	if exists {
-		return guid, nil
+// client returns the current routing API client.
+func (r *RoutingAPI) client() routing_api.Client {
+	r.apiClientLock.RLock()
+	defer r.apiClientLock.RUnlock()
+	return r.apiClient
+}
+
+// SetAPIClient replaces the routing API client, e.g. because its TLS config
+// changed. Requests already in flight finish with the previous client. The
+// current token is set on the new client.
+func (r *RoutingAPI) SetAPIClient(apiClient routing_api.Client) {
+	r.tokenLock.Lock()
+	defer r.tokenLock.Unlock()
+
+	if r.token != nil {
+		apiClient.SetToken(r.token.AccessToken)
 	}
 
-	routerGroup, err := r.apiClient.RouterGroupWithName(name)
+	r.apiClientLock.Lock()
+	r.apiClient = apiClient
+	r.apiClientLock.Unlock()
+}
+
+func (r *RoutingAPI) tokenValid() bool {
+	if r.token == nil {
+		return false
+	}
+	if r.token.Expiry.IsZero() {
+		return true
+	}
+	return r.clock.Now().Add(tokenExpiryBuffer).Before(r.token.Expiry)
+}
+
+func (r *RoutingAPI) untilTokenRefresh() time.Duration {
+	r.tokenLock.Lock()
+	defer r.tokenLock.Unlock()
+
+	if r.token == nil || r.token.Expiry.IsZero() {
+		return tokenRetryInterval
+	}
+
+	wait := r.token.Expiry.Add(-tokenExpiryBuffer).Sub(r.clock.Now())
+	if wait < tokenRetryInterval {
+		return tokenRetryInterval
+	}
+	return wait
+}
+
+// withTokenRetry makes the request and, if the routing API rejects the token,
+// makes it once more with a new token.
+func (r *RoutingAPI) withTokenRetry(request func() error) error {
+	err := request()
+	if !isUnauthorized(err) {
+		return err
+	}
+
+	r.logger.Info("token-rejected", lager.Data{"error": err.Error()})
+	refreshErr := r.forceRefreshToken()
+	if refreshErr != nil {
+		return err
+	}
+	return request()
+}
+
+func isUnauthorized(err error) bool {
+	var apiErr routing_api.Error
+	return errors.As(err, &apiErr) && apiErr.Type == routing_api.UnauthorizedError
+}
+
+type cachedRouterGroup struct {
+	routerGroup models.RouterGroup
+	fetchedAt   time.Time
+}
+
+func (r *RoutingAPI) getRouterGroup(name string) (models.RouterGroup, error) {
+	r.routerGroupLock.Lock()
+	cached, exists := r.routerGroups[name]
+	r.routerGroupLock.Unlock()
+
+	if exists && r.clock.Since(cached.fetchedAt) < routerGroupCacheTTL {
+		return cached.routerGroup, nil
+	}
+
+	var routerGroup models.RouterGroup
+	err := r.withTokenRetry(func() (err error) {
+		routerGroup, err = r.client().RouterGroupWithName(name)
+		return err
+	})
 	if err != nil {
-		return "", err
+		return models.RouterGroup{}, err
 	}
 	if routerGroup.Guid == "" {
-		return "", fmt.Errorf("Router group '%s' not found", name)
+		r.evictRouterGroup(name)
+		return models.RouterGroup{}, fmt.Errorf("Router group '%s' not found", name)
+	}
+
+	if !exists {
+		r.logger.Info("Mapped new router group", lager.Data{
+			"router_group": name,
+			"guid":         routerGroup.Guid})
+	} else if cached.routerGroup.Guid != routerGroup.Guid {
+		r.logger.Info("Remapped router group", lager.Data{
+			"router_group": name,
+			"old_guid":     cached.routerGroup.Guid,
+			"guid":         routerGroup.Guid})
+	}
+
+	r.routerGroupLock.Lock()
+	r.routerGroups[name] = cachedRouterGroup{routerGroup: routerGroup, fetchedAt: r.clock.Now()}
+	r.routerGroupLock.Unlock()
+	return routerGroup, nil
+}
+
+func (r *RoutingAPI) evictRouterGroup(name string) {
+	r.routerGroupLock.Lock()
+	defer r.routerGroupLock.Unlock()
+	delete(r.routerGroups, name)
+}
+
+// evictRouterGroupsOnError forgets the router groups of the mappings if the
+// routing API rejected them, so that they are looked up again by name. The
+// routing API rejects mappings for a router group GUID that no longer exists
+// as invalid. It returns whether any router group was evicted.
+func (r *RoutingAPI) evictRouterGroupsOnError(err error, mappings []models.TcpRouteMapping) bool {
+	var apiErr routing_api.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Type != routing_api.TcpRouteMappingInvalidError && apiErr.Type != routing_api.ResourceNotFoundError {
+		return false
+	}
+
+	r.routerGroupLock.Lock()
+	defer r.routerGroupLock.Unlock()
+
+	evicted := false
+	for name, cached := range r.routerGroups {
+		for _, mapping := range mappings {
+			if cached.routerGroup.Guid == mapping.RouterGroupGuid {
+				r.logger.Info("Evicted router group", lager.Data{
+					"router_group": name,
+					"guid":         cached.routerGroup.Guid,
+					"error":        err.Error()})
+				delete(r.routerGroups, name)
+				evicted = true
+				break
+			}
+		}
+	}
+	return evicted
+}
+
+// ValidateRouterGroupPorts checks that the external port of every TCP route
+// is one of the reservable ports of its router group. Only ports that are
+// definitely not reservable are returned as errors. Router groups that cannot
+// be fetched, or whose reservable ports cannot be parsed, are logged and
+// skipped, as registering the routes is retried anyway.
+func (r *RoutingAPI) ValidateRouterGroupPorts(routes []config.Route) error {
+	errors := multierror.NewMultiError("routing_api")
+
+	for _, route := range routes {
+		if route.Type != "tcp" || route.ExternalPort == nil {
+			continue
+		}
+
+		err := r.refreshToken()
+		if err != nil {
+			r.logger.Error("Failed to refresh UAA token", err)
+			break
+		}
+
+		routerGroup, err := r.getRouterGroup(route.RouterGroup)
+		if err != nil {
+			r.logger.Error("Failed to validate router group ports", err, lager.Data{"route": route.Name, "router_group": route.RouterGroup})
+			continue
+		}
+
+		reservable, err := isReservablePort(routerGroup.ReservablePorts, *route.ExternalPort)
+		if err != nil {
+			r.logger.Error("Failed to validate router group ports", err, lager.Data{"route": route.Name, "router_group": route.RouterGroup, "reservable_ports": routerGroup.ReservablePorts})
+			continue
+		}
+		if !reservable {
+			errors.Add(fmt.Errorf("route %q: external_port %d is not in the reservable_ports '%s' of router group '%s'", route.Name, *route.ExternalPort, routerGroup.ReservablePorts, route.RouterGroup))
+		}
 	}
 
-	r.logger.Info("Mapped new router group", lager.Data{
-		"router_group": name,
-		"guid":         routerGroup.Guid})
+	if errors.Length() > 0 {
+		return errors
+	}
+	return nil
+}
+
+func isReservablePort(reservablePorts models.ReservablePorts, port uint16) (bool, error) {
+	ranges, err := reservablePorts.Parse()
+	if err != nil {
+		return false, err
+	}
 
-	r.routerGroupGUID[name] = routerGroup.Guid
-	return routerGroup.Guid, nil
+	for _, portRange := range ranges {
+		start, end := portRange.Endpoints()
+		if uint64(port) >= start && uint64(port) <= end {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func (r *RoutingAPI) makeTcpRouteMapping(route config.Route) (models.TcpRouteMapping, error) {
-	routerGroupGUID, err := r.getRouterGroupGUID(route.RouterGroup)
+	routerGroup, err := r.getRouterGroup(route.RouterGroup)
 	if err != nil {
 		return models.TcpRouteMapping{}, err
 	}
 
 	r.logger.Info("Creating mapping", lager.Data{})
 
+	hostTLSPort := -1
+	if route.TLSPort != nil {
+		hostTLSPort = int(*route.TLSPort)
+	}
+
 	return models.NewTcpRouteMapping(
-		routerGroupGUID,
+		routerGroup.Guid,
 		*route.ExternalPort,
 		route.Host,
 		*route.Port,
-		-1,
-		"",
+		hostTLSPort,
+		route.InstanceID,
 		nilIfEmpty(&route.ServerCertDomainSAN),
 		calculateTTL(route.RegistrationInterval, r.routingAPIMaxTTL),
 		models.ModificationTag{},
 	), nil
 }
 
+type ownedRoute struct {
+	route      config.Route
+	mappingKey string
+}
+
+// own records that the route is healthy and registered as the mapping, so
+// that it can be registered again when the mapping is deleted by someone else.
+func (r *RoutingAPI) own(route config.Route, mapping models.TcpRouteMapping) {
+	r.ownedRoutesLock.Lock()
+	defer r.ownedRoutesLock.Unlock()
+	r.ownedRoutes[routeMappingKey(route)] = ownedRoute{route: route, mappingKey: tcpRouteMappingKey(mapping)}
+}
+
+func (r *RoutingAPI) disown(route config.Route) {
+	r.ownedRoutesLock.Lock()
+	defer r.ownedRoutesLock.Unlock()
+	delete(r.ownedRoutes, routeMappingKey(route))
+}
+
+// ownedRoute returns the route that is registered as the mapping, if any.
+func (r *RoutingAPI) ownedRoute(mapping models.TcpRouteMapping) (config.Route, bool) {
+	r.ownedRoutesLock.Lock()
+	defer r.ownedRoutesLock.Unlock()
+
+	key := tcpRouteMappingKey(mapping)
+	for _, owned := range r.ownedRoutes {
+		if owned.mappingKey == key {
+			return owned.route, true
+		}
+	}
+	return config.Route{}, false
+}
+
 const TTL_BUFFER float64 = 2.1
 
 // add a buffer to the registration interval so that it is not the same as the
@@ -131,18 +430,29 @@ func (r *RoutingAPI) RegisterRoute(route config.Route) error {
 		return err
 	}
 
-	err = r.apiClient.UpsertTcpRouteMappings([]models.TcpRouteMapping{
-		routeMapping})
+	upsert := func() error {
+		return r.client().UpsertTcpRouteMappings([]models.TcpRouteMapping{routeMapping})
+	}
+	err = r.withTokenRetry(upsert)
+	if err != nil && r.evictRouterGroupsOnError(err, []models.TcpRouteMapping{routeMapping}) {
+		routeMapping, err = r.makeTcpRouteMapping(route)
+		if err == nil {
+			err = r.withTokenRetry(upsert)
+		}
+	}
 	if err != nil {
 		r.logger.Error("Failed to upsert route mapping", err, lager.Data{"route-mapping": routeMapping})
 		return err
 	}
 
+	r.own(route, routeMapping)
 	r.logger.Info("Upserted route", lager.Data{"route-mapping": routeMapping})
 	return nil
 }
 
 func (r *RoutingAPI) UnregisterRoute(route config.Route) error {
+	r.disown(route)
+
 	err := r.refreshToken()
 	if err != nil {
 		r.logger.Error("Failed to refresh UAA token", err)
@@ -155,8 +465,11 @@ func (r *RoutingAPI) UnregisterRoute(route config.Route) error {
 		return err
 	}
 
-	err = r.apiClient.DeleteTcpRouteMappings([]models.TcpRouteMapping{routeMapping})
+	err = r.withTokenRetry(func() error {
+		return r.client().DeleteTcpRouteMappings([]models.TcpRouteMapping{routeMapping})
+	})
 	if err != nil {
+		r.evictRouterGroupsOnError(err, []models.TcpRouteMapping{routeMapping})
 		r.logger.Error("Failed to delete route mapping", err, lager.Data{"route-mapping": routeMapping})
 		return err
 	}
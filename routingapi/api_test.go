@@ -9,6 +9,8 @@ import (
 
 	fakeuaa "code.cloudfoundry.org/route-registrar/routingapi/routingapifakes"
 
+	"code.cloudfoundry.org/clock"
+
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/lager/v3/lagertest"
 	"code.cloudfoundry.org/route-registrar/config"
@@ -34,7 +36,7 @@ var _ = Describe("Routing API", func() {
 		uaaClient.FetchTokenReturns(&oauth2.Token{AccessToken: "my-token"}, nil)
 		client = &fake_routing_api.FakeClient{}
 		client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "router-group-guid"}, nil)
-		api = NewRoutingAPI(logger, uaaClient, client, 2*time.Minute)
+		api = NewRoutingAPI(logger, clock.NewClock(), uaaClient, client, 2*time.Minute)
 
 		port = 1234
 		externalPort = 5678
@@ -61,4 +63,40 @@ var _ = Describe("Routing API", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(tcpRouteMapping.SniHostname).To(BeNil())
 	})
+
+	It("sets the host TLS port and instance ID if TLSPort is present.", func() {
+		tlsPort := uint16(1443)
+		tcpRouteMapping, err := api.makeTcpRouteMapping(config.Route{
+			Port:         &port,
+			TLSPort:      &tlsPort,
+			InstanceID:   "instance-id",
+			ExternalPort: &externalPort,
+			RouterGroup:  "my-router-group",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tcpRouteMapping.HostTLSPort).To(Equal(1443))
+		Expect(tcpRouteMapping.InstanceId).To(Equal("instance-id"))
+	})
+
+	It("uses IPv6 backend hosts without brackets.", func() {
+		tcpRouteMapping, err := api.makeTcpRouteMapping(config.Route{
+			Host:         "::1",
+			Port:         &port,
+			ExternalPort: &externalPort,
+			RouterGroup:  "my-router-group",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tcpRouteMapping.HostIP).To(Equal("::1"))
+	})
+
+	It("host TLS port -1 if TLSPort is not present.", func() {
+		tcpRouteMapping, err := api.makeTcpRouteMapping(config.Route{
+			Port:         &port,
+			ExternalPort: &externalPort,
+			RouterGroup:  "my-router-group",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tcpRouteMapping.HostTLSPort).To(Equal(-1))
+		Expect(tcpRouteMapping.InstanceId).To(BeEmpty())
+	})
 })
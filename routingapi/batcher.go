@@ -0,0 +1,280 @@
+package routingapi
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/route-registrar/config"
+	"code.cloudfoundry.org/routing-api/models"
+)
+
+// Batcher collects the TCP route mappings registered and unregistered within
+// a window and sends them to the routing API with one upsert and one delete
+// request per window, instead of one request per route.
+type Batcher struct {
+	logger     lager.Logger
+	routingAPI *RoutingAPI
+	clock      clock.Clock
+	window     time.Duration
+
+	lock    sync.Mutex
+	upserts *pendingRoutes
+	deletes *pendingRoutes
+}
+
+func NewBatcher(logger lager.Logger, routingAPI *RoutingAPI, clock clock.Clock, window time.Duration) *Batcher {
+	return &Batcher{
+		logger:     logger.Session("batcher"),
+		routingAPI: routingAPI,
+		clock:      clock,
+		window:     window,
+		upserts:    newPendingRoutes(),
+		deletes:    newPendingRoutes(),
+	}
+}
+
+// RegisterRoute queues the route to be upserted on the next flush. It
+// replaces a pending unregistration of the same mapping.
+func (b *Batcher) RegisterRoute(route config.Route) error {
+	key := routeMappingKey(route)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.deletes.remove(key)
+	b.upserts.add(key, route)
+	return nil
+}
+
+// UnregisterRoute queues the route to be deleted on the next flush. It
+// replaces a pending registration of the same mapping.
+func (b *Batcher) UnregisterRoute(route config.Route) error {
+	key := routeMappingKey(route)
+
+	b.routingAPI.disown(route)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.upserts.remove(key)
+	b.deletes.add(key, route)
+	return nil
+}
+
+// RegisterHTTPRoute registers the HTTP route right away. HTTP routes are not
+// batched.
+func (b *Batcher) RegisterHTTPRoute(route config.Route) error {
+	return b.routingAPI.RegisterHTTPRoute(route)
+}
+
+// UnregisterHTTPRoute unregisters the HTTP route right away.
+func (b *Batcher) UnregisterHTTPRoute(route config.Route) error {
+	return b.routingAPI.UnregisterHTTPRoute(route)
+}
+
+func (b *Batcher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := b.clock.NewTicker(b.window)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-ticker.C():
+			b.Flush()
+		case <-signals:
+			b.logger.Info("flushing-before-exit")
+			b.Flush()
+			return nil
+		}
+	}
+}
+
+// Flush sends all queued mappings to the routing API. A failure of one
+// mapping does not prevent the others from being sent. When no token can be
+// fetched, the mappings are queued again for the next flush.
+func (b *Batcher) Flush() {
+	b.lock.Lock()
+	upserts, deletes := b.upserts, b.deletes
+	b.upserts, b.deletes = newPendingRoutes(), newPendingRoutes()
+	b.lock.Unlock()
+
+	if upserts.empty() && deletes.empty() {
+		return
+	}
+
+	err := b.routingAPI.refreshToken()
+	if err != nil {
+		b.logger.Error("Failed to refresh UAA token", err)
+		b.requeue(upserts, deletes)
+		return
+	}
+
+	upsertRoutes, upsertMappings := b.makeTcpRouteMappings(upserts, b.routingAPI.own)
+	if len(upsertMappings) > 0 {
+		b.send("upsert", upsertRoutes, upsertMappings, b.routingAPI.own, b.routingAPI.client().UpsertTcpRouteMappings)
+		b.logger.Info("Upserted routes", lager.Data{"count": len(upsertMappings)})
+	}
+
+	deleteRoutes, deleteMappings := b.makeTcpRouteMappings(deletes, nil)
+	if len(deleteMappings) > 0 {
+		b.send("delete", deleteRoutes, deleteMappings, nil, b.routingAPI.client().DeleteTcpRouteMappings)
+		b.logger.Info("Deleted routes", lager.Data{"count": len(deleteMappings)})
+	}
+}
+
+// requeue puts the routes of a flush that could not be sent back in front of
+// the queue, unless they were registered or unregistered again since.
+func (b *Batcher) requeue(upserts, deletes *pendingRoutes) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	newUpserts, newDeletes := b.upserts, b.deletes
+	b.upserts = upserts.requeue(newUpserts, newDeletes)
+	b.deletes = deletes.requeue(newDeletes, newUpserts)
+}
+
+// makeTcpRouteMappings makes the mappings of the pending routes, calling made
+// for each route whose mapping could be made. It returns the routes whose
+// mappings could be made along with their mappings.
+func (b *Batcher) makeTcpRouteMappings(pending *pendingRoutes, made func(config.Route, models.TcpRouteMapping)) ([]config.Route, []models.TcpRouteMapping) {
+	routes := []config.Route{}
+	mappings := []models.TcpRouteMapping{}
+	for _, route := range pending.list() {
+		mapping, err := b.routingAPI.makeTcpRouteMapping(route)
+		if err != nil {
+			b.logger.Error("Failed to make route mapping", err, lager.Data{"route": route})
+			continue
+		}
+		if made != nil {
+			made(route, mapping)
+		}
+		routes = append(routes, route)
+		mappings = append(mappings, mapping)
+	}
+	return routes, mappings
+}
+
+// send makes a single request for all mappings. If that request fails, every
+// mapping is retried on its own so that one rejected mapping does not fail
+// the whole batch. When the failure evicted router groups, the mappings are
+// made again for the retries, calling made for each of them, so that they use
+// the current router group GUIDs.
+func (b *Batcher) send(action string, routes []config.Route, mappings []models.TcpRouteMapping, made func(config.Route, models.TcpRouteMapping), request func([]models.TcpRouteMapping) error) {
+	err := b.routingAPI.withTokenRetry(func() error { return request(mappings) })
+	if err == nil {
+		return
+	}
+	evicted := b.routingAPI.evictRouterGroupsOnError(err, mappings)
+
+	if len(mappings) == 1 && !evicted {
+		b.logger.Error(fmt.Sprintf("Failed to %s route mapping", action), err, lager.Data{"route-mapping": mappings[0]})
+		return
+	}
+
+	if len(mappings) > 1 {
+		b.logger.Error(fmt.Sprintf("Failed to %s route mappings, retrying individually", action), err, lager.Data{"count": len(mappings)})
+	}
+	for i, route := range routes {
+		mapping := mappings[i]
+		if evicted {
+			mapping, err = b.routingAPI.makeTcpRouteMapping(route)
+			if err != nil {
+				b.logger.Error("Failed to make route mapping", err, lager.Data{"route": route})
+				continue
+			}
+			if made != nil {
+				made(route, mapping)
+			}
+		}
+
+		err := b.routingAPI.withTokenRetry(func() error { return request([]models.TcpRouteMapping{mapping}) })
+		if err != nil {
+			b.logger.Error(fmt.Sprintf("Failed to %s route mapping", action), err, lager.Data{"route-mapping": mapping})
+		}
+	}
+}
+
+// routeMappingKey identifies the routing API mapping a route results in, so
+// that a route registered several times within a window is sent once.
+func routeMappingKey(route config.Route) string {
+	return fmt.Sprintf("%s|%d|%s|%d|%s",
+		route.RouterGroup,
+		uint16Value(route.ExternalPort),
+		route.Host,
+		uint16Value(route.Port),
+		route.ServerCertDomainSAN,
+	)
+}
+
+func uint16Value(i *uint16) uint16 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// pendingRoutes is a set of routes keyed by mapping that keeps the order in
+// which the routes were first added.
+type pendingRoutes struct {
+	keys   []string
+	routes map[string]config.Route
+}
+
+func newPendingRoutes() *pendingRoutes {
+	return &pendingRoutes{routes: make(map[string]config.Route)}
+}
+
+func (p *pendingRoutes) add(key string, route config.Route) {
+	if _, exists := p.routes[key]; !exists {
+		p.keys = append(p.keys, key)
+	}
+	p.routes[key] = route
+}
+
+func (p *pendingRoutes) remove(key string) {
+	if _, exists := p.routes[key]; !exists {
+		return
+	}
+	delete(p.routes, key)
+	for i, k := range p.keys {
+		if k == key {
+			p.keys = append(p.keys[:i], p.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *pendingRoutes) has(key string) bool {
+	_, exists := p.routes[key]
+	return exists
+}
+
+// requeue returns the routes followed by the newer routes, leaving out the
+// routes that were queued for the opposite action since.
+func (p *pendingRoutes) requeue(newer, opposite *pendingRoutes) *pendingRoutes {
+	requeued := newPendingRoutes()
+	for _, key := range p.keys {
+		if !opposite.has(key) {
+			requeued.add(key, p.routes[key])
+		}
+	}
+	for _, key := range newer.keys {
+		requeued.add(key, newer.routes[key])
+	}
+	return requeued
+}
+
+func (p *pendingRoutes) empty() bool {
+	return len(p.keys) == 0
+}
+
+func (p *pendingRoutes) list() []config.Route {
+	routes := make([]config.Route, 0, len(p.keys))
+	for _, key := range p.keys {
+		routes = append(routes, p.routes[key])
+	}
+	return routes
+}
@@ -0,0 +1,309 @@
+package routingapi_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+	"golang.org/x/oauth2"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/route-registrar/config"
+	"code.cloudfoundry.org/route-registrar/routingapi"
+	fakeuaa "code.cloudfoundry.org/route-registrar/routingapi/routingapifakes"
+	routing_api "code.cloudfoundry.org/routing-api"
+	"code.cloudfoundry.org/routing-api/fake_routing_api"
+	"code.cloudfoundry.org/routing-api/models"
+)
+
+var _ = Describe("Batcher", func() {
+	var (
+		client    *fake_routing_api.FakeClient
+		uaaClient *fakeuaa.FakeUaaClient
+		logger    *lagertest.TestLogger
+		clock     *fakeclock.FakeClock
+
+		batcher *routingapi.Batcher
+
+		routeA config.Route
+		routeB config.Route
+	)
+
+	newRoute := func(name string, port, externalPort uint16) config.Route {
+		return config.Route{
+			Name:                 name,
+			Port:                 &port,
+			ExternalPort:         &externalPort,
+			Host:                 "myhost",
+			RegistrationInterval: 20 * time.Second,
+			RouterGroup:          "my-router-group",
+		}
+	}
+
+	expectedMapping := func(port, externalPort int) models.TcpRouteMapping {
+		ttl := 42
+		return models.TcpRouteMapping{TcpMappingEntity: models.TcpMappingEntity{
+			RouterGroupGuid: "router-group-guid",
+			HostPort:        uint16(port),
+			ExternalPort:    uint16(externalPort),
+			HostIP:          "myhost",
+			HostTLSPort:     -1,
+			TTL:             &ttl,
+		}}
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("batcher test")
+		uaaClient = &fakeuaa.FakeUaaClient{}
+		uaaClient.FetchTokenReturns(&oauth2.Token{AccessToken: "my-token"}, nil)
+		client = &fake_routing_api.FakeClient{}
+		client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "router-group-guid"}, nil)
+		clock = fakeclock.NewFakeClock(time.Now())
+
+		api := routingapi.NewRoutingAPI(logger, clock, uaaClient, client, 2*time.Minute)
+		batcher = routingapi.NewBatcher(logger, api, clock, time.Second)
+
+		routeA = newRoute("route-a", 1234, 5678)
+		routeB = newRoute("route-b", 1235, 5679)
+	})
+
+	Describe("Flush", func() {
+		It("sends all registered routes in a single upsert", func() {
+			Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+			Expect(batcher.RegisterRoute(routeB)).To(Succeed())
+			Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(0))
+
+			batcher.Flush()
+
+			Expect(uaaClient.FetchTokenCallCount()).To(Equal(1))
+			Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+			Expect(client.UpsertTcpRouteMappingsArgsForCall(0)).To(Equal([]models.TcpRouteMapping{
+				expectedMapping(1234, 5678),
+				expectedMapping(1235, 5679),
+			}))
+			Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+			Expect(logger).To(gbytes.Say("Upserted routes"))
+		})
+
+		It("sends all unregistered routes in a single delete", func() {
+			Expect(batcher.UnregisterRoute(routeA)).To(Succeed())
+			Expect(batcher.UnregisterRoute(routeB)).To(Succeed())
+
+			batcher.Flush()
+
+			Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+			Expect(client.DeleteTcpRouteMappingsArgsForCall(0)).To(Equal([]models.TcpRouteMapping{
+				expectedMapping(1234, 5678),
+				expectedMapping(1235, 5679),
+			}))
+			Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(0))
+		})
+
+		It("sends a route registered several times within the window once", func() {
+			Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+			Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+
+			batcher.Flush()
+
+			Expect(client.UpsertTcpRouteMappingsArgsForCall(0)).To(Equal([]models.TcpRouteMapping{
+				expectedMapping(1234, 5678),
+			}))
+		})
+
+		It("only sends the latest of a registration and unregistration of the same route", func() {
+			Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+			Expect(batcher.UnregisterRoute(routeA)).To(Succeed())
+
+			batcher.Flush()
+
+			Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(0))
+			Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+		})
+
+		It("does nothing when no routes are queued", func() {
+			batcher.Flush()
+
+			Expect(uaaClient.FetchTokenCallCount()).To(Equal(0))
+			Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(0))
+			Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+		})
+
+		It("clears the queue after flushing", func() {
+			Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+
+			batcher.Flush()
+			batcher.Flush()
+
+			Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+		})
+
+		Context("when the token cannot be fetched", func() {
+			BeforeEach(func() {
+				uaaClient.FetchTokenReturns(nil, errors.New("no token"))
+			})
+
+			It("does not send the mappings", func() {
+				Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+
+				batcher.Flush()
+
+				Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(0))
+				Expect(logger).To(gbytes.Say("Failed to refresh UAA token"))
+			})
+
+			It("sends the mappings on the next flush", func() {
+				Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+				Expect(batcher.UnregisterRoute(routeB)).To(Succeed())
+
+				batcher.Flush()
+				uaaClient.FetchTokenReturns(&oauth2.Token{AccessToken: "my-token"}, nil)
+				batcher.Flush()
+
+				Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+				Expect(client.UpsertTcpRouteMappingsArgsForCall(0)).To(Equal([]models.TcpRouteMapping{
+					expectedMapping(1234, 5678),
+				}))
+				Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+				Expect(client.DeleteTcpRouteMappingsArgsForCall(0)).To(Equal([]models.TcpRouteMapping{
+					expectedMapping(1235, 5679),
+				}))
+			})
+
+			It("does not requeue routes that were queued for the opposite action since", func() {
+				Expect(batcher.UnregisterRoute(routeA)).To(Succeed())
+
+				batcher.Flush()
+				Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+				uaaClient.FetchTokenReturns(&oauth2.Token{AccessToken: "my-token"}, nil)
+				batcher.Flush()
+
+				Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+				Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when the router group of one route cannot be found", func() {
+			BeforeEach(func() {
+				routeB.RouterGroup = "missing-router-group"
+				client.RouterGroupWithNameStub = func(name string) (models.RouterGroup, error) {
+					if name == "missing-router-group" {
+						return models.RouterGroup{}, nil
+					}
+					return models.RouterGroup{Guid: "router-group-guid"}, nil
+				}
+			})
+
+			It("sends the other mappings", func() {
+				Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+				Expect(batcher.RegisterRoute(routeB)).To(Succeed())
+
+				batcher.Flush()
+
+				Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+				Expect(client.UpsertTcpRouteMappingsArgsForCall(0)).To(Equal([]models.TcpRouteMapping{
+					expectedMapping(1234, 5678),
+				}))
+				Expect(logger).To(gbytes.Say("Failed to make route mapping"))
+			})
+		})
+
+		Context("when the batched request fails", func() {
+			BeforeEach(func() {
+				client.UpsertTcpRouteMappingsStub = func(mappings []models.TcpRouteMapping) error {
+					for _, m := range mappings {
+						if m.ExternalPort == 5679 {
+							return errors.New("rejected")
+						}
+					}
+					return nil
+				}
+			})
+
+			It("retries each mapping on its own", func() {
+				Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+				Expect(batcher.RegisterRoute(routeB)).To(Succeed())
+
+				batcher.Flush()
+
+				Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(3))
+				Expect(client.UpsertTcpRouteMappingsArgsForCall(1)).To(Equal([]models.TcpRouteMapping{
+					expectedMapping(1234, 5678),
+				}))
+				Expect(client.UpsertTcpRouteMappingsArgsForCall(2)).To(Equal([]models.TcpRouteMapping{
+					expectedMapping(1235, 5679),
+				}))
+				Expect(logger).To(gbytes.Say("Failed to upsert route mappings, retrying individually"))
+				Expect(logger).To(gbytes.Say("Failed to upsert route mapping"))
+			})
+		})
+	})
+
+	Context("when the routing API rejects the router group GUID of the batch", func() {
+		BeforeEach(func() {
+			client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "stale-router-group-guid"}, nil)
+			client.UpsertTcpRouteMappingsStub = func(mappings []models.TcpRouteMapping) error {
+				for _, m := range mappings {
+					if m.RouterGroupGuid == "stale-router-group-guid" {
+						return routing_api.NewError(routing_api.TcpRouteMappingInvalidError, "router group not found")
+					}
+				}
+				return nil
+			}
+		})
+
+		It("retries each mapping with a new GUID", func() {
+			Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+			Expect(batcher.RegisterRoute(routeB)).To(Succeed())
+
+			client.RouterGroupWithNameReturnsOnCall(1, models.RouterGroup{Guid: "router-group-guid"}, nil)
+			batcher.Flush()
+
+			Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(3))
+			Expect(client.UpsertTcpRouteMappingsArgsForCall(1)).To(Equal([]models.TcpRouteMapping{
+				expectedMapping(1234, 5678),
+			}))
+			Expect(client.UpsertTcpRouteMappingsArgsForCall(2)).To(Equal([]models.TcpRouteMapping{
+				expectedMapping(1235, 5679),
+			}))
+			Expect(logger).To(gbytes.Say("Evicted router group"))
+		})
+	})
+
+	Describe("Run", func() {
+		var process ifrit.Process
+
+		BeforeEach(func() {
+			process = ifrit.Invoke(batcher)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		})
+
+		It("flushes once per window", func() {
+			Expect(batcher.RegisterRoute(routeA)).To(Succeed())
+			Expect(batcher.RegisterRoute(routeB)).To(Succeed())
+			Consistently(client.UpsertTcpRouteMappingsCallCount).Should(Equal(0))
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+
+			Eventually(client.UpsertTcpRouteMappingsCallCount).Should(Equal(1))
+			Expect(client.UpsertTcpRouteMappingsArgsForCall(0)).To(HaveLen(2))
+		})
+
+		It("flushes the queued routes when signalled", func() {
+			Expect(batcher.UnregisterRoute(routeA)).To(Succeed())
+
+			process.Signal(os.Interrupt)
+
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,75 @@
+package routingapi
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/route-registrar/config"
+	"code.cloudfoundry.org/routing-api/models"
+)
+
+func (r *RoutingAPI) makeHTTPRoutes(route config.Route) ([]models.Route, error) {
+	if route.Port == nil {
+		return nil, fmt.Errorf("route %q has no port", route.Name)
+	}
+
+	ttl := calculateTTL(route.RegistrationInterval, r.routingAPIMaxTTL)
+
+	routes := []models.Route{}
+	for _, uri := range route.URIs {
+		routes = append(routes, models.NewRoute(uri, *route.Port, route.Host, route.App, route.RouteServiceUrl, ttl))
+	}
+	return routes, nil
+}
+
+// RegisterHTTPRoute upserts one HTTP route per URI of the route.
+func (r *RoutingAPI) RegisterHTTPRoute(route config.Route) error {
+	err := r.refreshToken()
+	if err != nil {
+		r.logger.Error("Failed to refresh UAA token", err)
+		return err
+	}
+
+	routes, err := r.makeHTTPRoutes(route)
+	if err != nil {
+		r.logger.Error("Failed to make HTTP routes", err, lager.Data{"route": route})
+		return err
+	}
+
+	err = r.withTokenRetry(func() error {
+		return r.client().UpsertRoutes(routes)
+	})
+	if err != nil {
+		r.logger.Error("Failed to upsert HTTP routes", err, lager.Data{"routes": routes})
+		return err
+	}
+
+	r.logger.Info("Upserted HTTP routes", lager.Data{"routes": routes})
+	return nil
+}
+
+// UnregisterHTTPRoute deletes the HTTP routes of the URIs of the route.
+func (r *RoutingAPI) UnregisterHTTPRoute(route config.Route) error {
+	err := r.refreshToken()
+	if err != nil {
+		r.logger.Error("Failed to refresh UAA token", err)
+		return err
+	}
+
+	routes, err := r.makeHTTPRoutes(route)
+	if err != nil {
+		r.logger.Error("Failed to make HTTP routes", err, lager.Data{"route": route})
+		return err
+	}
+
+	err = r.withTokenRetry(func() error {
+		return r.client().DeleteRoutes(routes)
+	})
+	if err != nil {
+		r.logger.Error("Failed to delete HTTP routes", err, lager.Data{"routes": routes})
+		return err
+	}
+
+	r.logger.Info("Deleted HTTP routes", lager.Data{"routes": routes})
+	return nil
+}
@@ -0,0 +1,108 @@
+package routingapi
+
+import (
+	"fmt"
+	"net"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/route-registrar/config"
+	"code.cloudfoundry.org/routing-api/models"
+)
+
+// ReconcileTcpRouteMappings deletes the TCP route mappings in the routing API
+// that point at host, the host of this registrar, but do not belong to any of
+// the routes. These are left behind when a previous registrar crashed or its
+// configuration changed, and would otherwise only disappear when their TTL
+// expires. Mappings pointing at other hosts are never deleted, even when some
+// of the routes point at them, as they may belong to other registrars. When
+// dryRun is true, the mappings are only logged.
+func (r *RoutingAPI) ReconcileTcpRouteMappings(host string, routes []config.Route, dryRun bool) error {
+	logger := r.logger.Session("reconcile-tcp-route-mappings", lager.Data{"dry-run": dryRun})
+
+	err := r.refreshToken()
+	if err != nil {
+		logger.Error("Failed to refresh UAA token", err)
+		return err
+	}
+
+	current := map[string]bool{}
+	for _, route := range routes {
+		if route.Type != "tcp" {
+			continue
+		}
+
+		mapping, err := r.makeTcpRouteMapping(route)
+		if err != nil {
+			logger.Error("Failed to make route mapping", err, lager.Data{"route": route})
+			return err
+		}
+		current[tcpRouteMappingKey(mapping)] = true
+	}
+
+	var mappings []models.TcpRouteMapping
+	err = r.withTokenRetry(func() (err error) {
+		mappings, err = r.client().TcpRouteMappings()
+		return err
+	})
+	if err != nil {
+		logger.Error("Failed to list route mappings", err)
+		return err
+	}
+
+	stale := []models.TcpRouteMapping{}
+	for _, mapping := range mappings {
+		if canonicalHost(mapping.HostIP) == canonicalHost(host) && !current[tcpRouteMappingKey(mapping)] {
+			stale = append(stale, mapping)
+		}
+	}
+
+	if len(stale) == 0 {
+		logger.Info("No stale route mappings")
+		return nil
+	}
+
+	if dryRun {
+		for _, mapping := range stale {
+			logger.Info("Would delete stale route mapping", lager.Data{"route-mapping": mapping})
+		}
+		return nil
+	}
+
+	err = r.withTokenRetry(func() error {
+		return r.client().DeleteTcpRouteMappings(stale)
+	})
+	if err != nil {
+		logger.Error("Failed to delete stale route mappings", err, lager.Data{"route-mappings": stale})
+		return err
+	}
+
+	logger.Info("Deleted stale route mappings", lager.Data{"route-mappings": stale})
+	return nil
+}
+
+// tcpRouteMappingKey identifies a mapping the way the routing API does, so
+// that mappings that only differ in TTL or modification tag are the same.
+func tcpRouteMappingKey(mapping models.TcpRouteMapping) string {
+	sniHostname := ""
+	if mapping.SniHostname != nil {
+		sniHostname = *mapping.SniHostname
+	}
+
+	return fmt.Sprintf("%s|%d|%s|%d|%s",
+		mapping.RouterGroupGuid,
+		mapping.ExternalPort,
+		canonicalHost(mapping.HostIP),
+		mapping.HostPort,
+		sniHostname,
+	)
+}
+
+// canonicalHost returns IP addresses in their canonical form, so that IPv6
+// addresses written differently compare equal.
+func canonicalHost(host string) string {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	return ip.String()
+}
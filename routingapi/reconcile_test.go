@@ -0,0 +1,162 @@
+package routingapi_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"golang.org/x/oauth2"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/route-registrar/config"
+	"code.cloudfoundry.org/route-registrar/routingapi"
+	fakeuaa "code.cloudfoundry.org/route-registrar/routingapi/routingapifakes"
+	"code.cloudfoundry.org/routing-api/fake_routing_api"
+	"code.cloudfoundry.org/routing-api/models"
+)
+
+var _ = Describe("ReconcileTcpRouteMappings", func() {
+	var (
+		client    *fake_routing_api.FakeClient
+		uaaClient *fakeuaa.FakeUaaClient
+		logger    *lagertest.TestLogger
+
+		api *routingapi.RoutingAPI
+
+		routes []config.Route
+		dryRun bool
+
+		current, otherHost, staleOnHost, staleOnRouteHost models.TcpRouteMapping
+	)
+
+	mapping := func(hostIP string, hostPort, externalPort uint16) models.TcpRouteMapping {
+		return models.NewTcpRouteMapping("router-group-guid", externalPort, hostIP, hostPort, -1, "", nil, 10, models.ModificationTag{})
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("reconcile test")
+		uaaClient = &fakeuaa.FakeUaaClient{}
+		uaaClient.FetchTokenReturns(&oauth2.Token{AccessToken: "my-token"}, nil)
+		client = &fake_routing_api.FakeClient{}
+		client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "router-group-guid"}, nil)
+		api = routingapi.NewRoutingAPI(logger, fakeclock.NewFakeClock(time.Now()), uaaClient, client, 2*time.Minute)
+
+		port := uint16(1234)
+		externalPort := uint16(5678)
+		otherPort := uint16(1236)
+		otherExternalPort := uint16(9999)
+		routes = []config.Route{
+			{
+				Name:                 "current",
+				Type:                 "tcp",
+				Host:                 "10.0.0.1",
+				Port:                 &port,
+				ExternalPort:         &externalPort,
+				RouterGroup:          "my-router-group",
+				RegistrationInterval: 20 * time.Second,
+			},
+			{
+				Name:                 "on-another-host",
+				Type:                 "tcp",
+				Host:                 "10.0.0.4",
+				Port:                 &otherPort,
+				ExternalPort:         &otherExternalPort,
+				RouterGroup:          "my-router-group",
+				RegistrationInterval: 20 * time.Second,
+			},
+			{
+				Name: "http",
+				Host: "10.0.0.3",
+				Port: &port,
+			},
+		}
+		dryRun = false
+
+		current = mapping("10.0.0.1", 1234, 5678)
+		otherHost = mapping("10.0.0.2", 1235, 5679)
+		staleOnHost = mapping("10.0.0.1", 1235, 5679)
+		staleOnRouteHost = mapping("10.0.0.4", 1236, 5680)
+		client.TcpRouteMappingsReturns([]models.TcpRouteMapping{current, otherHost, staleOnHost, staleOnRouteHost}, nil)
+	})
+
+	It("deletes the mappings of this host that are not in the route set", func() {
+		Expect(api.ReconcileTcpRouteMappings("10.0.0.1", routes, dryRun)).To(Succeed())
+
+		Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+		Expect(client.DeleteTcpRouteMappingsArgsForCall(0)).To(ConsistOf(staleOnHost))
+		Expect(logger).To(gbytes.Say("Deleted stale route mappings"))
+	})
+
+	It("keeps the mappings of other hosts, even when a route points at them", func() {
+		Expect(api.ReconcileTcpRouteMappings("10.0.0.1", routes, dryRun)).To(Succeed())
+
+		Expect(client.DeleteTcpRouteMappingsArgsForCall(0)).NotTo(ContainElement(otherHost))
+		Expect(client.DeleteTcpRouteMappingsArgsForCall(0)).NotTo(ContainElement(staleOnRouteHost))
+	})
+
+	Context("when the host is an IPv6 address", func() {
+		BeforeEach(func() {
+			routes[0].Host = "::1"
+			current = mapping("::1", 1234, 5678)
+			staleOnHost = mapping("0:0:0:0:0:0:0:1", 1235, 5679)
+			client.TcpRouteMappingsReturns([]models.TcpRouteMapping{current, otherHost, staleOnHost}, nil)
+		})
+
+		It("matches the mappings of the host however the address is written", func() {
+			Expect(api.ReconcileTcpRouteMappings("::1", routes, dryRun)).To(Succeed())
+
+			Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+			Expect(client.DeleteTcpRouteMappingsArgsForCall(0)).To(ConsistOf(staleOnHost))
+		})
+	})
+
+	Context("in dry-run mode", func() {
+		BeforeEach(func() {
+			dryRun = true
+		})
+
+		It("logs the mappings it would delete without deleting them", func() {
+			Expect(api.ReconcileTcpRouteMappings("10.0.0.1", routes, dryRun)).To(Succeed())
+
+			Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+			Expect(logger).To(gbytes.Say(`Would delete stale route mapping.*"port":5679`))
+			Expect(logger).NotTo(gbytes.Say(`Would delete stale route mapping.*"port":5680`))
+		})
+	})
+
+	Context("when there are no stale mappings", func() {
+		BeforeEach(func() {
+			client.TcpRouteMappingsReturns([]models.TcpRouteMapping{current, otherHost}, nil)
+		})
+
+		It("does not delete anything", func() {
+			Expect(api.ReconcileTcpRouteMappings("10.0.0.1", routes, dryRun)).To(Succeed())
+
+			Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the mappings cannot be listed", func() {
+		BeforeEach(func() {
+			client.TcpRouteMappingsReturns(nil, errors.New("list failed"))
+		})
+
+		It("returns the error", func() {
+			Expect(api.ReconcileTcpRouteMappings("10.0.0.1", routes, dryRun)).To(MatchError("list failed"))
+			Expect(client.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the stale mappings cannot be deleted", func() {
+		BeforeEach(func() {
+			client.DeleteTcpRouteMappingsReturns(errors.New("delete failed"))
+		})
+
+		It("returns the error", func() {
+			Expect(api.ReconcileTcpRouteMappings("10.0.0.1", routes, dryRun)).To(MatchError("delete failed"))
+		})
+	})
+})
@@ -2,15 +2,19 @@ package routingapi_test
 
 import (
 	"errors"
+	"os"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
 	"golang.org/x/oauth2"
 
-	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/route-registrar/config"
 	"code.cloudfoundry.org/route-registrar/routingapi"
+	routing_api "code.cloudfoundry.org/routing-api"
 	"code.cloudfoundry.org/routing-api/fake_routing_api"
 	"code.cloudfoundry.org/routing-api/models"
 
@@ -24,7 +28,8 @@ var _ = Describe("Routing API", func() {
 		uaaClient *fakeuaa.FakeUaaClient
 
 		api    *routingapi.RoutingAPI
-		logger lager.Logger
+		logger *lagertest.TestLogger
+		clock  *fakeclock.FakeClock
 
 		port                 uint16
 		externalPort         uint16
@@ -37,10 +42,11 @@ var _ = Describe("Routing API", func() {
 		maxTTL = 2 * time.Minute
 
 		logger = lagertest.NewTestLogger("routing api test")
+		clock = fakeclock.NewFakeClock(time.Now())
 		uaaClient = &fakeuaa.FakeUaaClient{}
 		uaaClient.FetchTokenReturns(&oauth2.Token{AccessToken: "my-token"}, nil)
 		client = &fake_routing_api.FakeClient{}
-		api = routingapi.NewRoutingAPI(logger, uaaClient, client, maxTTL)
+		api = routingapi.NewRoutingAPI(logger, clock, uaaClient, client, maxTTL)
 
 		port = 1234
 		externalPort = 5678
@@ -243,6 +249,394 @@ var _ = Describe("Routing API", func() {
 		})
 	})
 
+	Describe("HTTP routes", func() {
+		var route config.Route
+
+		BeforeEach(func() {
+			route = config.Route{
+				Name:                 "test-route",
+				Port:                 &port,
+				Host:                 "myhost",
+				App:                  "my-app",
+				URIs:                 []string{"my-app.example.com", "my-app.example.com/path"},
+				RouteServiceUrl:      "https://route-service.example.com",
+				RegistrationInterval: registrationInterval,
+			}
+		})
+
+		expectedRoutes := func() []models.Route {
+			return []models.Route{
+				models.NewRoute("my-app.example.com", 1234, "myhost", "my-app", "https://route-service.example.com", 42),
+				models.NewRoute("my-app.example.com/path", 1234, "myhost", "my-app", "https://route-service.example.com", 42),
+			}
+		}
+
+		Describe("RegisterHTTPRoute", func() {
+			It("upserts one route per URI", func() {
+				Expect(api.RegisterHTTPRoute(route)).To(Succeed())
+
+				Expect(client.SetTokenArgsForCall(0)).To(Equal("my-token"))
+				Expect(client.UpsertRoutesCallCount()).To(Equal(1))
+				Expect(client.UpsertRoutesArgsForCall(0)).To(Equal(expectedRoutes()))
+				Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(0))
+				Expect(logger).To(gbytes.Say("Upserted HTTP routes"))
+			})
+
+			Context("when the route has no port", func() {
+				BeforeEach(func() {
+					route.Port = nil
+				})
+
+				It("returns an error", func() {
+					err := api.RegisterHTTPRoute(route)
+					Expect(err).To(MatchError(`route "test-route" has no port`))
+					Expect(client.UpsertRoutesCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the routing api returns an error", func() {
+				BeforeEach(func() {
+					client.UpsertRoutesReturns(errors.New("routing api unavailable"))
+				})
+
+				It("returns the error", func() {
+					err := api.RegisterHTTPRoute(route)
+					Expect(err).To(MatchError("routing api unavailable"))
+				})
+			})
+		})
+
+		Describe("UnregisterHTTPRoute", func() {
+			It("deletes one route per URI", func() {
+				Expect(api.UnregisterHTTPRoute(route)).To(Succeed())
+
+				Expect(client.DeleteRoutesCallCount()).To(Equal(1))
+				Expect(client.DeleteRoutesArgsForCall(0)).To(Equal(expectedRoutes()))
+				Expect(logger).To(gbytes.Say("Deleted HTTP routes"))
+			})
+
+			Context("when the routing api returns an error", func() {
+				BeforeEach(func() {
+					client.DeleteRoutesReturns(errors.New("routing api unavailable"))
+				})
+
+				It("returns the error", func() {
+					err := api.UnregisterHTTPRoute(route)
+					Expect(err).To(MatchError("routing api unavailable"))
+				})
+			})
+		})
+	})
+
+	Describe("router groups", func() {
+		var route config.Route
+
+		BeforeEach(func() {
+			client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "router-group-guid"}, nil)
+
+			route = config.Route{
+				Name:                 "test-route",
+				Type:                 "tcp",
+				Port:                 &port,
+				ExternalPort:         &externalPort,
+				Host:                 "myhost",
+				RegistrationInterval: registrationInterval,
+				RouterGroup:          "my-router-group",
+			}
+		})
+
+		It("caches the router group GUID", func() {
+			Expect(api.RegisterRoute(route)).To(Succeed())
+			Expect(api.RegisterRoute(route)).To(Succeed())
+
+			Expect(client.RouterGroupWithNameCallCount()).To(Equal(1))
+		})
+
+		It("looks the router group up again after the cache TTL", func() {
+			Expect(api.RegisterRoute(route)).To(Succeed())
+
+			client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "new-router-group-guid"}, nil)
+			clock.Increment(5 * time.Minute)
+
+			Expect(api.RegisterRoute(route)).To(Succeed())
+			Expect(client.RouterGroupWithNameCallCount()).To(Equal(2))
+			Expect(client.UpsertTcpRouteMappingsArgsForCall(1)[0].RouterGroupGuid).To(Equal("new-router-group-guid"))
+			Expect(logger).To(gbytes.Say("Remapped router group"))
+		})
+
+		Context("when the routing API rejects the router group GUID", func() {
+			BeforeEach(func() {
+				client.UpsertTcpRouteMappingsReturnsOnCall(1, routing_api.NewError(routing_api.TcpRouteMappingInvalidError, "router group not found"))
+			})
+
+			It("evicts the router group and retries with a new GUID", func() {
+				Expect(api.RegisterRoute(route)).To(Succeed())
+
+				client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "new-router-group-guid"}, nil)
+				Expect(api.RegisterRoute(route)).To(Succeed())
+
+				Expect(client.RouterGroupWithNameCallCount()).To(Equal(2))
+				Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(3))
+				Expect(client.UpsertTcpRouteMappingsArgsForCall(2)[0].RouterGroupGuid).To(Equal("new-router-group-guid"))
+				Expect(logger).To(gbytes.Say("Evicted router group"))
+			})
+		})
+
+		Context("when the routing API returns another error", func() {
+			BeforeEach(func() {
+				client.UpsertTcpRouteMappingsReturnsOnCall(1, errors.New("connection refused"))
+			})
+
+			It("keeps the router group cached", func() {
+				Expect(api.RegisterRoute(route)).To(Succeed())
+				Expect(api.RegisterRoute(route)).To(MatchError("connection refused"))
+				Expect(api.RegisterRoute(route)).To(Succeed())
+
+				Expect(client.RouterGroupWithNameCallCount()).To(Equal(1))
+			})
+		})
+
+		Describe("ValidateRouterGroupPorts", func() {
+			BeforeEach(func() {
+				client.RouterGroupWithNameReturns(models.RouterGroup{
+					Guid:            "router-group-guid",
+					ReservablePorts: "1024-1033,5678",
+				}, nil)
+			})
+
+			It("accepts external ports within the reservable ports", func() {
+				otherPort := uint16(1030)
+				otherRoute := route
+				otherRoute.Name = "other-route"
+				otherRoute.ExternalPort = &otherPort
+
+				Expect(api.ValidateRouterGroupPorts([]config.Route{route, otherRoute})).To(Succeed())
+				Expect(client.RouterGroupWithNameCallCount()).To(Equal(1))
+			})
+
+			It("caches the router groups it looked up", func() {
+				Expect(api.ValidateRouterGroupPorts([]config.Route{route})).To(Succeed())
+				Expect(api.RegisterRoute(route)).To(Succeed())
+
+				Expect(client.RouterGroupWithNameCallCount()).To(Equal(1))
+			})
+
+			It("ignores routes that are not tcp routes", func() {
+				httpRoute := config.Route{Name: "http-route", Port: &port}
+
+				Expect(api.ValidateRouterGroupPorts([]config.Route{httpRoute})).To(Succeed())
+				Expect(client.RouterGroupWithNameCallCount()).To(Equal(0))
+			})
+
+			Context("when an external port is not reservable", func() {
+				BeforeEach(func() {
+					externalPort = 2000
+				})
+
+				It("returns an error", func() {
+					err := api.ValidateRouterGroupPorts([]config.Route{route})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring(`route "test-route": external_port 2000 is not in the reservable_ports '1024-1033,5678' of router group 'my-router-group'`))
+				})
+			})
+
+			Context("when the router group does not exist", func() {
+				BeforeEach(func() {
+					client.RouterGroupWithNameReturns(models.RouterGroup{}, nil)
+				})
+
+				It("logs the error and skips the route", func() {
+					Expect(api.ValidateRouterGroupPorts([]config.Route{route})).To(Succeed())
+					Expect(logger).To(gbytes.Say("Failed to validate router group ports"))
+					Expect(logger).To(gbytes.Say(`Router group 'my-router-group' not found`))
+				})
+			})
+
+			Context("when the router group cannot be fetched", func() {
+				BeforeEach(func() {
+					client.RouterGroupWithNameReturns(models.RouterGroup{}, errors.New("connection refused"))
+				})
+
+				It("logs the error and skips the route", func() {
+					Expect(api.ValidateRouterGroupPorts([]config.Route{route})).To(Succeed())
+					Expect(logger).To(gbytes.Say("Failed to validate router group ports"))
+					Expect(logger).To(gbytes.Say("connection refused"))
+				})
+			})
+
+			Context("when the reservable ports cannot be parsed", func() {
+				BeforeEach(func() {
+					client.RouterGroupWithNameReturns(models.RouterGroup{
+						Guid:            "router-group-guid",
+						ReservablePorts: "not-a-port",
+					}, nil)
+				})
+
+				It("logs the error and skips the route", func() {
+					Expect(api.ValidateRouterGroupPorts([]config.Route{route})).To(Succeed())
+					Expect(logger).To(gbytes.Say("Failed to validate router group ports"))
+				})
+			})
+
+			Context("when the token cannot be fetched", func() {
+				BeforeEach(func() {
+					uaaClient.FetchTokenReturns(nil, errors.New("no token"))
+				})
+
+				It("logs the error without looking up router groups", func() {
+					Expect(api.ValidateRouterGroupPorts([]config.Route{route})).To(Succeed())
+					Expect(client.RouterGroupWithNameCallCount()).To(Equal(0))
+					Expect(logger).To(gbytes.Say("Failed to refresh UAA token"))
+				})
+			})
+		})
+	})
+
+	Describe("SetAPIClient", func() {
+		var route config.Route
+
+		BeforeEach(func() {
+			client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "router-group-guid"}, nil)
+			route = config.Route{
+				Name:                 "test-route",
+				Port:                 &port,
+				ExternalPort:         &externalPort,
+				Host:                 "myhost",
+				RegistrationInterval: registrationInterval,
+				RouterGroup:          "my-router-group",
+			}
+		})
+
+		It("sets the current token on the new client and uses it for subsequent requests", func() {
+			Expect(api.RegisterRoute(route)).To(Succeed())
+
+			newClient := &fake_routing_api.FakeClient{}
+			api.SetAPIClient(newClient)
+			Expect(newClient.SetTokenCallCount()).To(Equal(1))
+			Expect(newClient.SetTokenArgsForCall(0)).To(Equal("my-token"))
+
+			Expect(api.RegisterRoute(route)).To(Succeed())
+			Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+			Expect(newClient.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+		})
+	})
+
+	Describe("the UAA token", func() {
+		var route config.Route
+
+		BeforeEach(func() {
+			client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "router-group-guid"}, nil)
+			uaaClient.FetchTokenReturns(&oauth2.Token{AccessToken: "my-token", Expiry: clock.Now().Add(time.Minute)}, nil)
+
+			route = config.Route{
+				Name:                 "test-route",
+				Port:                 &port,
+				ExternalPort:         &externalPort,
+				Host:                 "myhost",
+				RegistrationInterval: registrationInterval,
+				RouterGroup:          "my-router-group",
+			}
+		})
+
+		It("is reused until shortly before it expires", func() {
+			Expect(api.RegisterRoute(route)).To(Succeed())
+			Expect(api.UnregisterRoute(route)).To(Succeed())
+			Expect(uaaClient.FetchTokenCallCount()).To(Equal(1))
+
+			clock.Increment(31 * time.Second)
+
+			Expect(api.RegisterRoute(route)).To(Succeed())
+			Expect(uaaClient.FetchTokenCallCount()).To(Equal(2))
+			_, forceUpdate := uaaClient.FetchTokenArgsForCall(1)
+			Expect(forceUpdate).To(BeTrue())
+		})
+
+		It("is never logged", func() {
+			Expect(api.RegisterRoute(route)).To(Succeed())
+			Expect(logger.Buffer()).NotTo(gbytes.Say("my-token"))
+		})
+
+		Context("when the routing API rejects the token", func() {
+			BeforeEach(func() {
+				client.UpsertTcpRouteMappingsReturnsOnCall(0, routing_api.NewError(routing_api.UnauthorizedError, "token expired"))
+			})
+
+			It("fetches a new token and retries once", func() {
+				Expect(api.RegisterRoute(route)).To(Succeed())
+
+				Expect(uaaClient.FetchTokenCallCount()).To(Equal(2))
+				Expect(client.SetTokenCallCount()).To(Equal(2))
+				Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(2))
+			})
+
+			Context("when the new token is rejected as well", func() {
+				BeforeEach(func() {
+					client.UpsertTcpRouteMappingsReturnsOnCall(1, routing_api.NewError(routing_api.UnauthorizedError, "still unauthorized"))
+				})
+
+				It("returns the error without retrying again", func() {
+					err := api.RegisterRoute(route)
+					Expect(err).To(MatchError("still unauthorized"))
+					Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(2))
+				})
+			})
+		})
+
+		Context("when the routing API returns another error", func() {
+			BeforeEach(func() {
+				client.UpsertTcpRouteMappingsReturns(errors.New("routing api unavailable"))
+			})
+
+			It("does not retry", func() {
+				Expect(api.RegisterRoute(route)).NotTo(Succeed())
+				Expect(uaaClient.FetchTokenCallCount()).To(Equal(1))
+				Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+			})
+		})
+
+		Describe("Run", func() {
+			var process ifrit.Process
+
+			JustBeforeEach(func() {
+				process = ifrit.Invoke(api)
+			})
+
+			AfterEach(func() {
+				process.Signal(os.Interrupt)
+				Eventually(process.Wait()).Should(Receive(BeNil()))
+			})
+
+			It("fetches a token right away", func() {
+				Eventually(uaaClient.FetchTokenCallCount).Should(Equal(1))
+			})
+
+			It("refreshes the token shortly before it expires", func() {
+				Eventually(uaaClient.FetchTokenCallCount).Should(Equal(1))
+				uaaClient.FetchTokenReturns(&oauth2.Token{AccessToken: "my-new-token", Expiry: clock.Now().Add(2 * time.Minute)}, nil)
+
+				clock.WaitForWatcherAndIncrement(29 * time.Second)
+				Consistently(uaaClient.FetchTokenCallCount).Should(Equal(1))
+
+				clock.Increment(time.Second)
+				Eventually(uaaClient.FetchTokenCallCount).Should(Equal(2))
+				Eventually(client.SetTokenArgsForCall).WithArguments(1).Should(Equal("my-new-token"))
+			})
+
+			Context("when the token cannot be fetched", func() {
+				BeforeEach(func() {
+					uaaClient.FetchTokenReturns(nil, errors.New("uaa down"))
+				})
+
+				It("retries", func() {
+					Eventually(uaaClient.FetchTokenCallCount).Should(Equal(1))
+
+					clock.WaitForWatcherAndIncrement(5 * time.Second)
+					Eventually(uaaClient.FetchTokenCallCount).Should(Equal(2))
+				})
+			})
+		})
+	})
+
 	Context("when an error occurs", func() {
 		Context("when a UAA token cannot be fetched", func() {
 			BeforeEach(func() {
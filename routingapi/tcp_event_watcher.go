@@ -0,0 +1,137 @@
+package routingapi
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	routing_api "code.cloudfoundry.org/routing-api"
+)
+
+const (
+	minEventStreamBackoff = time.Second
+	maxEventStreamBackoff = time.Minute
+
+	deleteEventAction = "Delete"
+	expireEventAction = "Expire"
+)
+
+// TcpEventWatcher subscribes to the TCP route events of the routing API and
+// registers a healthy route again as soon as its mapping is removed, instead
+// of waiting for the next registration interval.
+type TcpEventWatcher struct {
+	logger     lager.Logger
+	routingAPI *RoutingAPI
+	clock      clock.Clock
+}
+
+func NewTcpEventWatcher(logger lager.Logger, routingAPI *RoutingAPI, clock clock.Clock) *TcpEventWatcher {
+	return &TcpEventWatcher{
+		logger:     logger.Session("tcp-event-watcher"),
+		routingAPI: routingAPI,
+		clock:      clock,
+	}
+}
+
+func (w *TcpEventWatcher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+
+	backoff := minEventStreamBackoff
+	for {
+		source, err := w.subscribe()
+		if err != nil {
+			w.logger.Error("failed-to-subscribe", err)
+		} else {
+			w.logger.Info("subscribed")
+			backoff = minEventStreamBackoff
+			if w.handleEvents(source, signals) {
+				return nil
+			}
+		}
+
+		w.logger.Info("reconnecting", lager.Data{"backoff": backoff.String()})
+		select {
+		case <-w.clock.After(backoff):
+		case <-signals:
+			return nil
+		}
+
+		backoff *= 2
+		if backoff > maxEventStreamBackoff {
+			backoff = maxEventStreamBackoff
+		}
+	}
+}
+
+func (w *TcpEventWatcher) subscribe() (routing_api.TcpEventSource, error) {
+	err := w.routingAPI.refreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var source routing_api.TcpEventSource
+	err = w.routingAPI.withTokenRetry(func() (err error) {
+		source, err = w.routingAPI.client().SubscribeToTcpEvents()
+		return err
+	})
+	return source, err
+}
+
+// handleEvents handles the events of the source until it fails or a signal is
+// received. It returns whether a signal was received.
+func (w *TcpEventWatcher) handleEvents(source routing_api.TcpEventSource, signals <-chan os.Signal) bool {
+	events := make(chan routing_api.TcpEvent)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	defer source.Close()
+
+	go func() {
+		for {
+			event, err := source.Next()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			w.handleEvent(event)
+		case err := <-errs:
+			w.logger.Error("event-stream-failed", err)
+			return false
+		case <-signals:
+			return true
+		}
+	}
+}
+
+func (w *TcpEventWatcher) handleEvent(event routing_api.TcpEvent) {
+	if event.Action != deleteEventAction && event.Action != expireEventAction {
+		return
+	}
+
+	route, owned := w.routingAPI.ownedRoute(event.TcpRouteMapping)
+	if !owned {
+		return
+	}
+
+	w.logger.Info("re-registering-removed-route", lager.Data{
+		"action":        event.Action,
+		"route-mapping": event.TcpRouteMapping,
+	})
+	err := w.routingAPI.RegisterRoute(route)
+	if err != nil {
+		w.logger.Error("failed-to-re-register-route", err, lager.Data{"route": route})
+	}
+}
@@ -0,0 +1,173 @@
+package routingapi_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+	"golang.org/x/oauth2"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/route-registrar/config"
+	"code.cloudfoundry.org/route-registrar/routingapi"
+	fakeuaa "code.cloudfoundry.org/route-registrar/routingapi/routingapifakes"
+	routing_api "code.cloudfoundry.org/routing-api"
+	"code.cloudfoundry.org/routing-api/fake_routing_api"
+	"code.cloudfoundry.org/routing-api/models"
+)
+
+var _ = Describe("TcpEventWatcher", func() {
+	var (
+		client    *fake_routing_api.FakeClient
+		uaaClient *fakeuaa.FakeUaaClient
+		logger    *lagertest.TestLogger
+		clock     *fakeclock.FakeClock
+
+		api     *routingapi.RoutingAPI
+		watcher *routingapi.TcpEventWatcher
+		process ifrit.Process
+
+		source *fake_routing_api.FakeTcpEventSource
+		events chan routing_api.TcpEvent
+
+		route   config.Route
+		mapping models.TcpRouteMapping
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("tcp event watcher test")
+		uaaClient = &fakeuaa.FakeUaaClient{}
+		uaaClient.FetchTokenReturns(&oauth2.Token{AccessToken: "my-token"}, nil)
+		client = &fake_routing_api.FakeClient{}
+		client.RouterGroupWithNameReturns(models.RouterGroup{Guid: "router-group-guid"}, nil)
+		clock = fakeclock.NewFakeClock(time.Now())
+
+		events = make(chan routing_api.TcpEvent)
+		sourceEvents := events
+		sourceClosed := make(chan struct{})
+		var closeOnce sync.Once
+
+		source = &fake_routing_api.FakeTcpEventSource{}
+		source.NextStub = func() (routing_api.TcpEvent, error) {
+			select {
+			case event, ok := <-sourceEvents:
+				if ok {
+					return event, nil
+				}
+			case <-sourceClosed:
+			}
+			return routing_api.TcpEvent{}, errors.New("stream closed")
+		}
+		source.CloseStub = func() error {
+			closeOnce.Do(func() { close(sourceClosed) })
+			return nil
+		}
+		client.SubscribeToTcpEventsReturns(source, nil)
+
+		api = routingapi.NewRoutingAPI(logger, clock, uaaClient, client, 2*time.Minute)
+		watcher = routingapi.NewTcpEventWatcher(logger, api, clock)
+
+		port := uint16(1234)
+		externalPort := uint16(5678)
+		route = config.Route{
+			Name:                 "test-route",
+			Type:                 "tcp",
+			Port:                 &port,
+			ExternalPort:         &externalPort,
+			Host:                 "myhost",
+			RegistrationInterval: 20 * time.Second,
+			RouterGroup:          "my-router-group",
+		}
+		mapping = models.NewTcpRouteMapping("router-group-guid", 5678, "myhost", 1234, -1, "", nil, 0, models.ModificationTag{})
+	})
+
+	JustBeforeEach(func() {
+		process = ifrit.Invoke(watcher)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	Context("when a registered route is deleted", func() {
+		BeforeEach(func() {
+			Expect(api.RegisterRoute(route)).To(Succeed())
+		})
+
+		It("registers it again", func() {
+			Eventually(client.SubscribeToTcpEventsCallCount).Should(Equal(1))
+			Expect(client.UpsertTcpRouteMappingsCallCount()).To(Equal(1))
+
+			events <- routing_api.TcpEvent{Action: "Delete", TcpRouteMapping: mapping}
+
+			Eventually(client.UpsertTcpRouteMappingsCallCount).Should(Equal(2))
+			Expect(logger).To(gbytes.Say("re-registering-removed-route"))
+		})
+
+		It("ignores upserts", func() {
+			events <- routing_api.TcpEvent{Action: "Upsert", TcpRouteMapping: mapping}
+
+			Consistently(client.UpsertTcpRouteMappingsCallCount).Should(Equal(1))
+		})
+	})
+
+	Context("when an unregistered route is deleted", func() {
+		BeforeEach(func() {
+			Expect(api.RegisterRoute(route)).To(Succeed())
+			Expect(api.UnregisterRoute(route)).To(Succeed())
+		})
+
+		It("does not register it again", func() {
+			events <- routing_api.TcpEvent{Action: "Delete", TcpRouteMapping: mapping}
+
+			Consistently(client.UpsertTcpRouteMappingsCallCount).Should(Equal(1))
+		})
+	})
+
+	Context("when a mapping of someone else is deleted", func() {
+		It("does not register it", func() {
+			events <- routing_api.TcpEvent{Action: "Delete", TcpRouteMapping: mapping}
+
+			Consistently(client.UpsertTcpRouteMappingsCallCount).Should(Equal(0))
+		})
+	})
+
+	Context("when the event stream fails", func() {
+		It("subscribes again with backoff", func() {
+			Eventually(client.SubscribeToTcpEventsCallCount).Should(Equal(1))
+			close(events)
+
+			Eventually(logger).Should(gbytes.Say("event-stream-failed"))
+			Eventually(source.CloseCallCount).Should(BeNumerically(">=", 1))
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(client.SubscribeToTcpEventsCallCount).Should(Equal(2))
+		})
+	})
+
+	Context("when subscribing fails", func() {
+		BeforeEach(func() {
+			client.SubscribeToTcpEventsReturns(nil, errors.New("subscribe failed"))
+		})
+
+		It("doubles the backoff between attempts", func() {
+			Eventually(client.SubscribeToTcpEventsCallCount).Should(Equal(1))
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(client.SubscribeToTcpEventsCallCount).Should(Equal(2))
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Consistently(client.SubscribeToTcpEventsCallCount).Should(Equal(2))
+			clock.Increment(time.Second)
+			Eventually(client.SubscribeToTcpEventsCallCount).Should(Equal(3))
+			Expect(logger).To(gbytes.Say("failed-to-subscribe"))
+		})
+	})
+})
@@ -0,0 +1,262 @@
+package tlsreloader
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/tlsconfig"
+)
+
+const expiryCheckInterval = time.Hour
+
+// certificateExpiry holds the seconds until the first certificate of each
+// loaded file expires, by path. It is published with expvar, so that expiry
+// can be monitored and not only found in the logs.
+var certificateExpiry = expvar.NewMap("certificate_expires_in_seconds")
+
+// Reloader holds a client certificate and a CA pool loaded from PEM files. It
+// loads them again when the files change, so that new TLS connections use
+// rotated certificates without restarting the registrar, and logs when one of
+// the certificates is about to expire.
+type Reloader struct {
+	logger        lager.Logger
+	clock         clock.Clock
+	certPath      string
+	keyPath       string
+	caPath        string
+	interval      time.Duration
+	expiryWarning time.Duration
+
+	lock        sync.RWMutex
+	certificate *tls.Certificate
+	caPool      *x509.CertPool
+	caCerts     []*x509.Certificate
+	contents    [][]byte
+
+	onReload        []func()
+	lastExpiryCheck time.Time
+}
+
+// NewReloader loads the certificate, key and CA files. The files are checked
+// for changes every interval once the reloader runs; an interval of 0
+// disables reloading.
+func NewReloader(logger lager.Logger, clock clock.Clock, certPath, keyPath, caPath string, interval, expiryWarning time.Duration) (*Reloader, error) {
+	r := &Reloader{
+		logger:        logger.Session("tls-reloader", lager.Data{"cert-path": certPath, "ca-path": caPath}),
+		clock:         clock,
+		certPath:      certPath,
+		keyPath:       keyPath,
+		caPath:        caPath,
+		interval:      interval,
+		expiryWarning: expiryWarning,
+	}
+
+	_, err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+	r.checkExpiry()
+
+	return r, nil
+}
+
+// ClientTLSConfig returns a client TLS config that presents the current
+// certificate on every handshake and verifies servers against the CA pool
+// loaded when it is called. The CA pool of a config in use cannot be swapped
+// safely, so callers build a new config in an OnReload callback, or use
+// RootCAs, to pick up a rotated CA. An empty serverName leaves setting it to
+// the caller, for example to a NATS client that connects to several servers.
+func (r *Reloader) ClientTLSConfig(serverName string) (*tls.Config, error) {
+	r.lock.RLock()
+	caPool := r.caPool
+	r.lock.RUnlock()
+
+	tlsConfig, err := tlsconfig.Build(tlsconfig.WithInternalServiceDefaults()).Client(
+		tlsconfig.WithAuthority(caPool),
+		tlsconfig.WithServerName(serverName),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		r.lock.RLock()
+		defer r.lock.RUnlock()
+		return r.certificate, nil
+	}
+
+	return tlsConfig, nil
+}
+
+// RootCAs returns the CA pool loaded last. Clients that build a TLS config
+// per connection, such as the NATS client on every reconnect, call it to
+// verify servers against a rotated CA without a new config.
+func (r *Reloader) RootCAs() (*x509.CertPool, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.caPool, nil
+}
+
+// OnReload registers a function that is called after the certificates have
+// been reloaded. It must be called before the reloader runs.
+func (r *Reloader) OnReload(f func()) {
+	r.onReload = append(r.onReload, f)
+}
+
+func (r *Reloader) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+
+	if r.interval <= 0 {
+		<-signals
+		return nil
+	}
+
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			reloaded, err := r.reload()
+			if err != nil {
+				r.logger.Error("failed-to-reload-certificates", err)
+			} else if reloaded {
+				r.logger.Info("reloaded-certificates")
+				for _, f := range r.onReload {
+					f()
+				}
+			}
+
+			if reloaded || r.clock.Since(r.lastExpiryCheck) >= expiryCheckInterval {
+				r.checkExpiry()
+			}
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// reload loads the files again if any of them changed. It keeps the current
+// certificates when the new ones cannot be loaded, for example while only
+// the certificate but not yet the key has been replaced.
+func (r *Reloader) reload() (bool, error) {
+	contents := make([][]byte, 3)
+	for i, path := range []string{r.certPath, r.keyPath, r.caPath} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		contents[i] = b
+	}
+
+	r.lock.RLock()
+	unchanged := r.contents != nil &&
+		bytes.Equal(contents[0], r.contents[0]) &&
+		bytes.Equal(contents[1], r.contents[1]) &&
+		bytes.Equal(contents[2], r.contents[2])
+	r.lock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return false, fmt.Errorf("failed to load key pair %q, %q: %s", r.certPath, r.keyPath, err)
+	}
+	if certificate.Leaf == nil {
+		certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			return false, fmt.Errorf("failed to parse certificate %q: %s", r.certPath, err)
+		}
+	}
+
+	caCerts, err := parseCertificates(contents[2])
+	if err != nil {
+		return false, fmt.Errorf("failed to load CA certificates %q: %s", r.caPath, err)
+	}
+	caPool := x509.NewCertPool()
+	for _, cert := range caCerts {
+		caPool.AddCert(cert)
+	}
+
+	r.lock.Lock()
+	r.certificate = &certificate
+	r.caPool = caPool
+	r.caCerts = caCerts
+	r.contents = contents
+	r.lock.Unlock()
+
+	return true, nil
+}
+
+// checkExpiry updates the expiry metric and logs every certificate that
+// expires within the expiry warning.
+func (r *Reloader) checkExpiry() {
+	r.lastExpiryCheck = r.clock.Now()
+
+	r.lock.RLock()
+	certs := map[string][]*x509.Certificate{
+		r.certPath: {r.certificate.Leaf},
+		r.caPath:   r.caCerts,
+	}
+	r.lock.RUnlock()
+
+	for path, pathCerts := range certs {
+		var firstExpiresIn time.Duration
+		for i, cert := range pathCerts {
+			expiresIn := cert.NotAfter.Sub(r.clock.Now())
+			if i == 0 || expiresIn < firstExpiresIn {
+				firstExpiresIn = expiresIn
+			}
+			if expiresIn > r.expiryWarning {
+				continue
+			}
+
+			r.logger.Error("certificate-expiring-soon", fmt.Errorf("certificate expires at %s", cert.NotAfter.UTC().Format(time.RFC3339)), lager.Data{
+				"path":               path,
+				"subject":            cert.Subject.String(),
+				"not-after":          cert.NotAfter.UTC().Format(time.RFC3339),
+				"expires-in-seconds": int64(expiresIn.Seconds()),
+			})
+		}
+
+		expiresInSeconds := new(expvar.Int)
+		expiresInSeconds.Set(int64(firstExpiresIn.Seconds()))
+		certificateExpiry.Set(path, expiresInSeconds)
+	}
+}
+
+func parseCertificates(pemCerts []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for len(pemCerts) > 0 {
+		var block *pem.Block
+		block, pemCerts = pem.Decode(pemCerts)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
@@ -0,0 +1,385 @@
+package tlsreloader_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"expvar"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/route-registrar/tlsreloader"
+)
+
+type certificateAuthority struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+	pem  []byte
+}
+
+func newCertificateAuthority() certificateAuthority {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	return certificateAuthority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca certificateAuthority) issue(commonName string, validFor time.Duration) ([]byte, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+var _ = Describe("Reloader", func() {
+	var (
+		logger *lagertest.TestLogger
+		clock  *fakeclock.FakeClock
+
+		ca       certificateAuthority
+		dir      string
+		certPath string
+		keyPath  string
+		caPath   string
+
+		expiryWarning time.Duration
+	)
+
+	writeFile := func(path string, contents []byte) {
+		Expect(os.WriteFile(path, contents, 0600)).To(Succeed())
+	}
+
+	writeKeyPair := func(commonName string) {
+		cert, key := ca.issue(commonName, 30*24*time.Hour)
+		writeFile(certPath, cert)
+		writeFile(keyPath, key)
+	}
+
+	clientCommonName := func(tlsConfig *tls.Config) string {
+		certificate, err := tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+		Expect(err).NotTo(HaveOccurred())
+		cert, err := x509.ParseCertificate(certificate.Certificate[0])
+		Expect(err).NotTo(HaveOccurred())
+		return cert.Subject.CommonName
+	}
+
+	newReloader := func() (*tlsreloader.Reloader, error) {
+		return tlsreloader.NewReloader(logger, clock, certPath, keyPath, caPath, time.Minute, expiryWarning)
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("tls reloader test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		expiryWarning = 7 * 24 * time.Hour
+
+		ca = newCertificateAuthority()
+		dir = GinkgoT().TempDir()
+		certPath = filepath.Join(dir, "client.crt")
+		keyPath = filepath.Join(dir, "client.key")
+		caPath = filepath.Join(dir, "ca.crt")
+
+		writeKeyPair("client-1")
+		writeFile(caPath, ca.pem)
+	})
+
+	Describe("NewReloader", func() {
+		It("loads the client certificate", func() {
+			reloader, err := newReloader()
+			Expect(err).NotTo(HaveOccurred())
+
+			tlsConfig, err := reloader.ClientTLSConfig("127.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clientCommonName(tlsConfig)).To(Equal("client-1"))
+			Expect(tlsConfig.MinVersion).To(BeNumerically(">=", tls.VersionTLS12))
+		})
+
+		Context("when a file is missing", func() {
+			BeforeEach(func() {
+				Expect(os.Remove(caPath)).To(Succeed())
+			})
+
+			It("returns an error", func() {
+				_, err := newReloader()
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when the certificate does not match the key", func() {
+			BeforeEach(func() {
+				cert, _ := ca.issue("other", time.Hour)
+				writeFile(certPath, cert)
+			})
+
+			It("returns an error", func() {
+				_, err := newReloader()
+				Expect(err).To(MatchError(ContainSubstring("failed to load key pair")))
+			})
+		})
+
+		Context("when the CA file has no certificates", func() {
+			BeforeEach(func() {
+				writeFile(caPath, []byte("not a certificate"))
+			})
+
+			It("returns an error", func() {
+				_, err := newReloader()
+				Expect(err).To(MatchError(ContainSubstring("no certificates found")))
+			})
+		})
+
+		Context("when a certificate expires within the expiry warning", func() {
+			BeforeEach(func() {
+				cert, key := ca.issue("client-1", 24*time.Hour)
+				writeFile(certPath, cert)
+				writeFile(keyPath, key)
+			})
+
+			It("logs a warning", func() {
+				_, err := newReloader()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(logger).To(gbytes.Say("certificate-expiring-soon"))
+				Expect(logger).To(gbytes.Say(certPath))
+			})
+		})
+
+		It("publishes the seconds until the certificates expire", func() {
+			_, err := newReloader()
+			Expect(err).NotTo(HaveOccurred())
+
+			certificateExpiry := expvar.Get("certificate_expires_in_seconds").(*expvar.Map)
+			Expect(certificateExpiry.Get(certPath).(*expvar.Int).Value()).To(BeNumerically("~", (30 * 24 * time.Hour).Seconds(), 60))
+			Expect(certificateExpiry.Get(caPath).(*expvar.Int).Value()).To(BeNumerically(">", (364 * 24 * time.Hour).Seconds()))
+		})
+
+		Context("when no certificate expires within the expiry warning", func() {
+			It("does not log a warning", func() {
+				_, err := newReloader()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(logger).NotTo(gbytes.Say("certificate-expiring-soon"))
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		var (
+			reloader  *tlsreloader.Reloader
+			tlsConfig *tls.Config
+			process   ifrit.Process
+		)
+
+		BeforeEach(func() {
+			var err error
+			reloader, err = newReloader()
+			Expect(err).NotTo(HaveOccurred())
+			tlsConfig, err = reloader.ClientTLSConfig("127.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+
+			process = ifrit.Invoke(reloader)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("reloads the certificate when the files change", func() {
+			writeKeyPair("client-2")
+
+			clock.WaitForWatcherAndIncrement(time.Minute)
+
+			Eventually(func() string { return clientCommonName(tlsConfig) }).Should(Equal("client-2"))
+			Expect(logger).To(gbytes.Say("reloaded-certificates"))
+		})
+
+		It("keeps the current certificate while the new key pair is incomplete", func() {
+			cert, key := ca.issue("client-2", 30*24*time.Hour)
+			writeFile(certPath, cert)
+
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(logger).Should(gbytes.Say("failed-to-reload-certificates"))
+			Expect(clientCommonName(tlsConfig)).To(Equal("client-1"))
+
+			writeFile(keyPath, key)
+
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(func() string { return clientCommonName(tlsConfig) }).Should(Equal("client-2"))
+		})
+
+		It("does not reload unchanged files", func() {
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			Consistently(logger).ShouldNot(gbytes.Say("reloaded-certificates"))
+		})
+	})
+
+	Describe("RootCAs", func() {
+		verify := func(pool *x509.CertPool, ca certificateAuthority) error {
+			certPEM, _ := ca.issue("server", 30*24*time.Hour)
+			block, _ := pem.Decode(certPEM)
+			cert, err := x509.ParseCertificate(block.Bytes)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cert.Verify(x509.VerifyOptions{Roots: pool})
+			return err
+		}
+
+		It("returns the CA pool loaded last", func() {
+			reloader, err := newReloader()
+			Expect(err).NotTo(HaveOccurred())
+
+			pool, err := reloader.RootCAs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verify(pool, ca)).To(Succeed())
+
+			rotatedCA := newCertificateAuthority()
+			writeFile(caPath, rotatedCA.pem)
+			process := ifrit.Invoke(reloader)
+			defer func() {
+				process.Signal(os.Interrupt)
+				Eventually(process.Wait()).Should(Receive(BeNil()))
+			}()
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(logger).Should(gbytes.Say("reloaded-certificates"))
+
+			pool, err = reloader.RootCAs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verify(pool, rotatedCA)).To(Succeed())
+			Expect(verify(pool, ca)).To(MatchError(ContainSubstring("certificate signed by unknown authority")))
+		})
+	})
+
+	Describe("ClientTLSConfig", func() {
+		var (
+			server   *httptest.Server
+			serverCA certificateAuthority
+		)
+
+		startServer := func(serverCA certificateAuthority) *httptest.Server {
+			certPEM, keyPEM := serverCA.issue("server", 30*24*time.Hour)
+			certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+			Expect(err).NotTo(HaveOccurred())
+
+			clientCAs := x509.NewCertPool()
+			clientCAs.AddCert(ca.cert)
+
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			server.TLS = &tls.Config{
+				Certificates: []tls.Certificate{certificate},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    clientCAs,
+			}
+			server.StartTLS()
+			return server
+		}
+
+		get := func(tlsConfig *tls.Config) error {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			return nil
+		}
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		Context("when the server certificate is signed by the CA", func() {
+			BeforeEach(func() {
+				server = startServer(ca)
+			})
+
+			It("completes a mutual TLS handshake", func() {
+				reloader, err := newReloader()
+				Expect(err).NotTo(HaveOccurred())
+				tlsConfig, err := reloader.ClientTLSConfig("127.0.0.1")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(get(tlsConfig)).To(Succeed())
+			})
+
+			It("rejects a server certificate for another server name", func() {
+				reloader, err := newReloader()
+				Expect(err).NotTo(HaveOccurred())
+				tlsConfig, err := reloader.ClientTLSConfig("10.0.0.1")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(get(tlsConfig)).To(MatchError(ContainSubstring("certificate is valid for 127.0.0.1, not 10.0.0.1")))
+			})
+		})
+
+		Context("when the server certificate is signed by another CA", func() {
+			BeforeEach(func() {
+				serverCA = newCertificateAuthority()
+				server = startServer(serverCA)
+			})
+
+			It("rejects the server until the CA file is rotated", func() {
+				reloader, err := newReloader()
+				Expect(err).NotTo(HaveOccurred())
+				tlsConfig, err := reloader.ClientTLSConfig("127.0.0.1")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(get(tlsConfig)).To(MatchError(ContainSubstring("certificate signed by unknown authority")))
+
+				reloadedConfigs := make(chan *tls.Config, 1)
+				reloader.OnReload(func() {
+					tlsConfig, err := reloader.ClientTLSConfig("127.0.0.1")
+					Expect(err).NotTo(HaveOccurred())
+					reloadedConfigs <- tlsConfig
+				})
+
+				writeFile(caPath, append(append([]byte{}, ca.pem...), serverCA.pem...))
+				process := ifrit.Invoke(reloader)
+				defer func() {
+					process.Signal(os.Interrupt)
+					Eventually(process.Wait()).Should(Receive(BeNil()))
+				}()
+				clock.WaitForWatcherAndIncrement(time.Minute)
+				Eventually(reloadedConfigs).Should(Receive(&tlsConfig))
+
+				Expect(get(tlsConfig)).To(Succeed())
+			})
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package tlsreloader_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTlsreloader(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tlsreloader Suite")
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/multierror"
+	"code.cloudfoundry.org/route-registrar/config"
+	"code.cloudfoundry.org/route-registrar/registrar"
+)
+
+const (
+	validateFormatHuman = "human"
+	validateFormatJSON  = "json"
+)
+
+type validationError struct {
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+type validationResult struct {
+	Valid         bool              `json:"valid"`
+	Routes        int               `json:"routes"`
+	DynamicRoutes int               `json:"dynamic_routes"`
+	Errors        []validationError `json:"errors"`
+	Skipped       []string          `json:"skipped"`
+}
+
+func (r *validationResult) add(source string, err error) {
+	r.Errors = append(r.Errors, validationError{Source: source, Error: err.Error()})
+}
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// validate implements the validate subcommand: it checks the config file, the
+// dynamic config files and the files they reference the way the
+// route-registrar would at startup, reports every error found and returns the
+// exit code. What depends on the machine the route-registrar runs on, such as
+// environment variables, secret files and the host detection, is reported as
+// skipped instead.
+func validate(args []string, stdout io.Writer, stderr io.Writer) int {
+	var (
+		configPath   string
+		format       string
+		dynamicGlobs stringsFlag
+	)
+
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&configPath, "configPath", "registrar_settings.yml", "path to JSON or YAML configuration file")
+	flags.Var(&dynamicGlobs, "dynamic-glob", "glob of dynamic config files to validate instead of the dynamic_config_globs of the configuration, may be repeated")
+	flags.StringVar(&format, "format", validateFormatHuman, "output format, human or json")
+
+	err := flags.Parse(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if format != validateFormatHuman && format != validateFormatJSON {
+		fmt.Fprintf(stderr, "unknown format %q: must be %s or %s\n", format, validateFormatHuman, validateFormatJSON)
+		return 2
+	}
+
+	result := validateConfig(configPath, dynamicGlobs)
+
+	if format == validateFormatJSON {
+		err = json.NewEncoder(stdout).Encode(result)
+	} else {
+		err = writeValidationResult(stdout, configPath, result)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to write result: %s\n", err)
+		return 2
+	}
+
+	if !result.Valid {
+		return 1
+	}
+	return 0
+}
+
+func validateConfig(configPath string, dynamicGlobs []string) validationResult {
+	result := validationResult{Errors: []validationError{}, Skipped: []string{}}
+
+	// Validation continues after errors in the config file, with whatever
+	// could be parsed, so that all errors are reported at once. Unknown
+	// fields are reported as a multierror with the parsed schema; when the
+	// file cannot be parsed at all, only the dynamic config files matching
+	// --dynamic-glob are validated.
+	c := &config.Config{}
+	configSchema, err := config.NewConfigSchemaFromFile(configPath)
+	if err != nil {
+		result.add(configPath, err)
+	}
+	if _, unknownFields := err.(*multierror.MultiError); err == nil || unknownFields {
+		var skipped []string
+		c, skipped, err = configSchema.ValidateSchema()
+		if err != nil {
+			result.add(configPath, err)
+		}
+		result.Skipped = append(result.Skipped, skipped...)
+		result.Routes = len(c.Routes)
+	}
+
+	if len(dynamicGlobs) > 0 {
+		c.DynamicConfigGlobs = dynamicGlobs
+	}
+
+	// The errors are returned instead of logged, so nothing needs to be logged.
+	dynamicRoutes, fileErrors, err := registrar.ValidateDynamicRoutes(lager.NewLogger("route-registrar"), *c)
+	if err != nil {
+		result.add("dynamic_config_globs", err)
+	}
+	result.DynamicRoutes = len(dynamicRoutes)
+
+	files := make([]string, 0, len(fileErrors))
+	for f := range fileErrors {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		for _, err := range fileErrors[f] {
+			result.add(f, err)
+		}
+	}
+
+	err = checkReferencedFiles(*c, dynamicRoutes)
+	if err != nil {
+		result.add(configPath, err)
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// checkReferencedFiles returns an error for each certificate, key or health
+// check script referenced by the config or the routes that does not exist.
+func checkReferencedFiles(c config.Config, dynamicRoutes []config.Route) error {
+	missingFiles := multierror.NewMultiError("referenced files")
+	checked := map[string]bool{}
+
+	check := func(field string, path string) {
+		if path == "" || checked[field+path] {
+			return
+		}
+		checked[field+path] = true
+
+		_, err := os.Stat(path)
+		if err != nil {
+			missingFiles.Add(fmt.Errorf("%s: %s", field, err))
+		}
+	}
+
+	if c.NATSmTLSConfig.Enabled {
+		check("nats_mtls_config.cert_path", c.NATSmTLSConfig.CertPath)
+		check("nats_mtls_config.key_path", c.NATSmTLSConfig.KeyPath)
+		check("nats_mtls_config.ca_path", c.NATSmTLSConfig.CAPath)
+	}
+
+	check("routing_api.ca_certs", c.RoutingAPI.CACerts)
+	check("routing_api.client_cert_path", c.RoutingAPI.ClientCertificatePath)
+	check("routing_api.client_private_key_path", c.RoutingAPI.ClientPrivateKeyPath)
+	check("routing_api.server_ca_cert_path", c.RoutingAPI.ServerCACertificatePath)
+
+	for _, route := range append(append([]config.Route{}, c.Routes...), dynamicRoutes...) {
+		if route.HealthCheck != nil {
+			check(fmt.Sprintf("health_check.script_path of route %q", route.Name), route.HealthCheck.ScriptPath)
+		}
+	}
+
+	if missingFiles.Length() > 0 {
+		return missingFiles
+	}
+	return nil
+}
+
+func writeValidationResult(w io.Writer, configPath string, result validationResult) error {
+	if len(result.Skipped) > 0 {
+		_, err := fmt.Fprintf(w, "%s: not checked, as it depends on the machine the route-registrar runs on:\n  %s\n", configPath, strings.Join(result.Skipped, "\n  "))
+		if err != nil {
+			return err
+		}
+	}
+
+	if result.Valid {
+		_, err := fmt.Fprintf(w, "%s is valid: %d static and %d dynamic routes\n", configPath, result.Routes, result.DynamicRoutes)
+		return err
+	}
+
+	for _, e := range result.Errors {
+		_, err := fmt.Fprintf(w, "%s:\n  %s\n", e.Source, strings.ReplaceAll(e.Error, "\n", "\n  "))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s is invalid\n", configPath)
+	return err
+}